@@ -0,0 +1,316 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/logging"
+)
+
+const (
+	defaultQueueCapacity = 1000
+	defaultBatchEntries  = 500
+	defaultBatchWait     = time.Second
+	defaultBatchBytes    = 5 << 20
+	maxErrorBodySize     = 512
+)
+
+func NewElastic(conf Config) (*elastic, error) {
+	if conf.Url == "" {
+		return nil, ConfigError.New("elastic url is required")
+	}
+
+	client, err := newHttpClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	bulkUrl, err := url.Parse(strings.TrimRight(conf.Url, "/") + "/_bulk")
+	if err != nil {
+		return nil, ConfigError.Wrap(err)
+	}
+	if conf.Pipeline != "" {
+		query := bulkUrl.Query()
+		query.Set("pipeline", conf.Pipeline)
+		bulkUrl.RawQuery = query.Encode()
+	}
+
+	opType := conf.OpType
+	switch opType {
+	case "":
+		opType = IndexOpType
+	case IndexOpType, CreateOpType:
+	default:
+		return nil, ConfigError.NewF("unknown bulk operation %q, expected one of index, create", string(opType))
+	}
+
+	formatter := conf.Formatter
+	if formatter == nil {
+		formatter = logging.NewJsonFormatter()
+	}
+
+	index := conf.Index
+	if index == "" {
+		index = DefaultIndex
+	}
+
+	dateLayout := conf.IndexDateLayout
+	if dateLayout == "" && !conf.DisableDailyIndex {
+		dateLayout = DefaultDateLayout
+	}
+
+	batchBytes := conf.BatchMaxBytes
+	if batchBytes <= 0 {
+		batchBytes = defaultBatchBytes
+	}
+
+	es := &elastic{
+		url:        bulkUrl.String(),
+		client:     client,
+		formatter:  formatter,
+		index:      index,
+		dateLayout: dateLayout,
+		opType:     opType,
+		batchBytes: batchBytes,
+		retry:      conf.Retry.WithDefaults(),
+		deadLetter: conf.DeadLetter,
+
+		basicAuthUser:     conf.BasicAuthUser,
+		basicAuthPassword: conf.BasicAuthPassword,
+		apiKey:            conf.ApiKey,
+		headers:           conf.Headers,
+	}
+
+	queue, err := logging.NewBatchQueue(
+		conf.Queue.WithDefaults(defaultQueueCapacity, logging.OverflowDropNewest),
+		conf.Batch.WithDefaults(defaultBatchEntries, defaultBatchWait),
+		es.sendBatch,
+	)
+	if err != nil {
+		return nil, err
+	}
+	es.queue = queue
+
+	return es, nil
+}
+
+type elastic struct {
+	url        string
+	client     *http.Client
+	queue      *logging.Queue
+	formatter  logging.Formatter
+	index      string
+	dateLayout string
+	opType     OpType
+	batchBytes int
+	retry      retry.Policy
+	deadLetter retry.DeadLetter
+	health     retry.Health
+
+	basicAuthUser     string
+	basicAuthPassword string
+	apiKey            string
+	headers           map[string]string
+}
+
+type document struct {
+	action []byte
+	source string
+	entry  logging.Entry
+}
+
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkItemResponse `json:"items"`
+}
+
+type bulkItemResponse struct {
+	Status int `json:"status"`
+	Error  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (e *elastic) Print(_ string, fields []logging.LogField) {
+	e.queue.Push(logging.Entry{Fields: fields})
+}
+
+func (e *elastic) Flush(ctx context.Context) error {
+	return e.queue.Flush(ctx)
+}
+
+func (e *elastic) Close() error {
+	return e.queue.Close()
+}
+
+func (e *elastic) Stats() logging.QueueStats {
+	return e.queue.Stats()
+}
+
+// Healthy reports whether the last bulk request was accepted, documents rejected permanently do not count
+func (e *elastic) Healthy() bool {
+	return e.health.Healthy()
+}
+
+// sendBatch renders entries into bulk documents and sends them in chunks limited by batchBytes
+func (e *elastic) sendBatch(ctx context.Context, entries []logging.Entry) {
+	var docs []document
+	size := 0
+
+	for _, entry := range entries {
+		action, err := json.Marshal(map[string]map[string]string{
+			string(e.opType): {"_index": e.indexName(entry.Fields)},
+		})
+		if err != nil {
+			retry.Drop(e.deadLetter, []logging.Entry{entry}, err)
+			continue
+		}
+
+		doc := document{action: action, source: e.formatter.Format(withTimestamp(entry.Fields)), entry: entry}
+		if size > 0 && size+len(doc.source) > e.batchBytes {
+			e.sendWithRetry(ctx, docs)
+			docs, size = nil, 0
+		}
+
+		docs = append(docs, doc)
+		size += len(doc.source)
+	}
+
+	if len(docs) > 0 {
+		e.sendWithRetry(ctx, docs)
+	}
+}
+
+// withTimestamp adds @timestamp required by data streams and used by default index templates,
+// fields already containing it are kept as they are
+func withTimestamp(fields []logging.LogField) []logging.LogField {
+	if _, ok := logging.FieldValue(fields, TimestampFieldKey); ok {
+		return fields
+	}
+
+	result := make([]logging.LogField, len(fields), len(fields)+1)
+	copy(result, fields)
+	return append(result, logging.LogField{
+		Name:  TimestampFieldKey,
+		Value: logging.EntryTime(fields).UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (e *elastic) indexName(fields []logging.LogField) string {
+	if e.dateLayout == "" {
+		return e.index
+	}
+
+	return e.index + "-" + logging.EntryTime(fields).UTC().Format(e.dateLayout)
+}
+
+// sendWithRetry resends only documents rejected with retryable item status,
+// documents rejected permanently and documents left after the last attempt are passed to dead letter
+func (e *elastic) sendWithRetry(ctx context.Context, docs []document) {
+	err := e.retry.Do(ctx, func() (err error) {
+		defer func() { e.health.Record(err) }()
+
+		failed, rejected, err := e.send(ctx, docs)
+		if err != nil {
+			return err
+		}
+
+		if len(rejected) > 0 {
+			retry.Drop(e.deadLetter, entries(rejected), retry.Permanent(ItemError.NewF("%d documents are rejected", len(rejected))))
+		}
+		if len(failed) > 0 {
+			docs = failed
+			return ItemError.NewF("%d documents are rejected with retryable status", len(failed))
+		}
+
+		return nil
+	})
+	if err != nil {
+		retry.Drop(e.deadLetter, entries(docs), err)
+	}
+}
+
+// send posts bulk request and splits rejected documents into retryable and permanently rejected ones
+func (e *elastic) send(ctx context.Context, docs []document) (failed, rejected []document, err error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		body.Write(doc.action)
+		body.WriteByte('\n')
+		body.WriteString(doc.source)
+		body.WriteByte('\n')
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, &body)
+	if err != nil {
+		return nil, nil, retry.Permanent(err)
+	}
+
+	e.setHeaders(request)
+	request.Header.Set("content-type", "application/x-ndjson")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		fmt.Println(fmt.Sprintf(
+			`{"error":%q,"message":"error during elastic bulk request","time":"%s"}`,
+			err.Error(), time.Now().UTC().Format(time.RFC3339)),
+		)
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return nil, nil, retry.StatusError(response.StatusCode, string(body))
+	}
+
+	var result bulkResponse
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, nil, retry.Permanent(err)
+	}
+	if !result.Errors {
+		return nil, nil, nil
+	}
+
+	for i, item := range result.Items {
+		if i >= len(docs) {
+			break
+		}
+
+		for _, status := range item {
+			if status.Status >= 200 && status.Status < 300 {
+				continue
+			}
+
+			fmt.Println(fmt.Sprintf(
+				`{"error":%q,"message":"document is rejected by elastic, status: %d","time":"%s"}`,
+				status.Error.Type+": "+status.Error.Reason, status.Status, time.Now().UTC().Format(time.RFC3339)),
+			)
+			if retry.RetryableStatus(status.Status) {
+				failed = append(failed, docs[i])
+			} else {
+				rejected = append(rejected, docs[i])
+			}
+		}
+	}
+
+	return failed, rejected, nil
+}
+
+func entries(docs []document) []logging.Entry {
+	result := make([]logging.Entry, len(docs))
+	for i, doc := range docs {
+		result[i] = doc.entry
+	}
+
+	return result
+}
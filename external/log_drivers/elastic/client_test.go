@@ -0,0 +1,136 @@
+package elastic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/logging"
+)
+
+type bulkServer struct {
+	mu      sync.Mutex
+	actions []map[string]map[string]string
+	sources []map[string]interface{}
+	// statuses are item statuses of the next responses, missing ones are 201
+	statuses [][]int
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var statuses []int
+	if len(s.statuses) > 0 {
+		statuses, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+
+	var items []map[string]bulkItemResponse
+	scanner := bufio.NewScanner(r.Body)
+	for i := 0; scanner.Scan(); i++ {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || !scanner.Scan() {
+			http.Error(w, "malformed bulk body", http.StatusBadRequest)
+			return
+		}
+		var source map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &source); err != nil {
+			http.Error(w, "malformed document", http.StatusBadRequest)
+			return
+		}
+
+		status := http.StatusCreated
+		if len(items) < len(statuses) {
+			status = statuses[len(items)]
+		}
+		if status == http.StatusCreated {
+			s.actions = append(s.actions, action)
+			s.sources = append(s.sources, source)
+		}
+		for op := range action {
+			items = append(items, map[string]bulkItemResponse{op: {Status: status}})
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(bulkResponse{Errors: len(statuses) > 0, Items: items})
+}
+
+func newTestElastic(t *testing.T, server *bulkServer, conf Config) *elastic {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	conf.Url = httpServer.URL
+	conf.Batch = logging.BatchConfig{MaxWait: 10 * time.Millisecond}
+	conf.Retry = retry.Policy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxAttempts: 3}
+	es, err := NewElastic(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = es.Close() })
+
+	return es
+}
+
+func TestElasticAddsTimestamp(t *testing.T) {
+	server := &bulkServer{}
+	es := newTestElastic(t, server, Config{Index: "app", OpType: CreateOpType, DisableDailyIndex: true})
+
+	es.Print("", []logging.LogField{
+		{Name: logging.MessageFieldKey, Value: "hello"},
+		{Name: logging.TimeFieldKey, Value: "2024-01-02T03:04:05.5Z"},
+	})
+	if err := es.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.sources) != 1 {
+		t.Fatalf("%d documents are indexed, expected 1", len(server.sources))
+	}
+	if got := server.actions[0]["create"]["_index"]; got != "app" {
+		t.Errorf("document is created in index %q, expected app", got)
+	}
+	if got := server.sources[0][TimestampFieldKey]; got != "2024-01-02T03:04:05.5Z" {
+		t.Errorf("document timestamp is %v", got)
+	}
+}
+
+func TestElasticRetriesOnlyRetryableItems(t *testing.T) {
+	server := &bulkServer{statuses: [][]int{{http.StatusTooManyRequests, http.StatusBadRequest, http.StatusCreated}}}
+
+	var dropped []logging.Entry
+	es := newTestElastic(t, server, Config{
+		DeadLetter: retry.DeadLetterFunc(func(entries []logging.Entry, err error) {
+			dropped = append(dropped, entries...)
+		}),
+	})
+
+	for _, message := range []string{"throttled", "invalid", "indexed"} {
+		es.Print("", []logging.LogField{{Name: logging.MessageFieldKey, Value: message}})
+	}
+	if err := es.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var indexed []string
+	for _, source := range server.sources {
+		indexed = append(indexed, source[logging.MessageFieldKey].(string))
+	}
+	if len(indexed) != 2 || indexed[0] != "indexed" || indexed[1] != "throttled" {
+		t.Errorf("indexed documents are %v, expected indexed and retried throttled", indexed)
+	}
+	if len(dropped) != 1 || logging.FieldString(dropped[0].Fields, logging.MessageFieldKey) != "invalid" {
+		t.Errorf("dead letter got %v, expected invalid document", dropped)
+	}
+}
@@ -0,0 +1,53 @@
+package elastic
+
+import (
+	"golibs/external/log_drivers/retry"
+	"golibs/external/log_drivers/tls_config"
+	"golibs/logging"
+)
+
+type OpType string
+
+const (
+	IndexOpType OpType = "index"
+	// CreateOpType is required by data streams
+	CreateOpType OpType = "create"
+)
+
+const (
+	DefaultIndex      = "logs"
+	DefaultDateLayout = "2006.01.02"
+	// TimestampFieldKey is added to every document with entry time
+	TimestampFieldKey = "@timestamp"
+)
+
+// Config is elasticsearch and opensearch printer configuration, zero values are replaced with defaults
+type Config struct {
+	// Url is cluster address, _bulk path is appended to it
+	Url        string
+	TimeOutSec int
+	// Index is index name or prefix of daily index name, defaults to logs
+	Index string
+	// IndexDateLayout is time layout of index suffix taken from entry time, defaults to 2006.01.02,
+	// set DisableDailyIndex to write every entry to Index
+	IndexDateLayout   string
+	DisableDailyIndex bool
+	// OpType defaults to index, use create for data streams
+	OpType   OpType
+	Pipeline string
+	// Formatter renders documents and must produce JSON objects, JSON is used when nil
+	Formatter logging.Formatter
+	Queue     logging.QueueConfig
+	Batch     logging.BatchConfig
+	// BatchMaxBytes limits documents size of single bulk request, defaults to 5MB
+	BatchMaxBytes int
+	// Retry repeats rejected documents only with 429 and 5xx item statuses
+	Retry      retry.Policy
+	DeadLetter retry.DeadLetter
+
+	BasicAuthUser     string
+	BasicAuthPassword string
+	ApiKey            string
+	Headers           map[string]string
+	TLS               tls_config.Config
+}
@@ -0,0 +1,9 @@
+package elastic
+
+import "golibs/errors"
+
+var (
+	ConfigError = errors.NewWrapper("invalid elastic config", errors.ValidationErrorType)
+	// ItemError is returned when bulk request is accepted but some documents are rejected
+	ItemError = errors.NewWrapper("bulk items are rejected")
+)
@@ -0,0 +1,43 @@
+package elastic
+
+import (
+	"net/http"
+	"time"
+
+	"golibs/external/log_drivers/tls_config"
+)
+
+const defaultTimeOutSec = 10
+
+func newHttpClient(conf Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConf, err := tls_config.New(conf.TLS, "")
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConf
+
+	timeOut := conf.TimeOutSec
+	if timeOut <= 0 {
+		timeOut = defaultTimeOutSec
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Second * time.Duration(timeOut),
+	}, nil
+}
+
+func (e *elastic) setHeaders(request *http.Request) {
+	for name, value := range e.headers {
+		request.Header.Set(name, value)
+	}
+
+	switch {
+	case e.apiKey != "":
+		request.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	case e.basicAuthUser != "":
+		request.SetBasicAuth(e.basicAuthUser, e.basicAuthPassword)
+	}
+}
@@ -1,138 +1,179 @@
 package gray_logs
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
+	"golibs/external/log_drivers/retry"
 	"golibs/logging"
+)
+
+const (
+	defaultQueueCapacity = 1000
+	containerNameField   = "_container_name"
+	defaultContainerName = "backend"
+	facilityField        = "_facility"
 
-	"github.com/Devatoria/go-graylog"
+	// SelfLogFieldKey marks driver own log entries, the driver does not send them to graylog,
+	// only the name is checked because redaction may mask the value
+	SelfLogFieldKey = "graylog_driver"
 )
 
+// NewGrayLogs panics when printer can not be created from conf, use New to handle the error
 func NewGrayLogs(conf Config, l logging.Logger) *grayLogsWriter {
-	chanel := make(chan []logging.LogField, 1000)
+	gl, err := New(conf, l)
+	if err != nil {
+		panic(err)
+	}
 
+	return gl
+}
+
+// New creates graylog printer, l receives driver own errors and may contain the printer itself
+func New(conf Config, l logging.Logger) (*grayLogsWriter, error) {
+	conf = conf.withDefaults()
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+
+	tlsConf, err := newTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
 	result := &grayLogsWriter{
-		chanel:  chanel,
-		host:    conf.HostName,
-		version: conf.Version,
-		conf:    conf,
-		logger:  l,
+		host:       conf.HostName,
+		version:    conf.Version,
+		conf:       conf,
+		retry:      conf.Retry.WithDefaults(),
+		connection: newConnection(conf, tlsConf),
+	}
+	if l != nil {
+		result.logger = l.WithField(SelfLogFieldKey, true)
+	}
+
+	if tlsConf != nil && tlsConf.InsecureSkipVerify {
+		result.warn("Graylog server certificate verification is disabled")
+	}
+	if conf.Transport == TCP && tlsConf == nil {
+		result.warn("Graylog TLS is disabled, using unsafe tcp connection")
+	}
+
+	err = result.connection.connect()
+	if err != nil {
+		result.error(err, "error during initialize connection to graylog host, will try to reconnect on next logs sending attempt")
 	}
 
-	err := result.connectToHost()
+	result.queue, err = logging.NewQueue(conf.Queue.WithDefaults(defaultQueueCapacity, logging.OverflowDropNewest), result.sendWithRetry)
 	if err != nil {
-		l.ErrorF(ConnectionError.Wrap(err), "error during initialize connection to graylog host, will try to reconnect on next logs sending attempt")
+		return nil, err
 	}
-	result.start(conf.TimeOut)
 
-	return result
+	return result, nil
 }
 
 type grayLogsWriter struct {
-	chanel  chan []logging.LogField
-	host    string
-	version string
-	logger  logging.Logger
-	conf    Config
-	writer  *graylog.Graylog
+	queue      *logging.Queue
+	host       string
+	version    string
+	logger     logging.Logger
+	conf       Config
+	connection *connection
+	retry      retry.Policy
 }
 
-func (g *grayLogsWriter) connectToHost() (err error) {
-	endPoint := graylog.Endpoint{
-		Transport: graylog.TCP,
-		Address:   g.conf.Addr,
-		Port:      g.conf.Port,
-	}
-
-	if len(g.conf.Certificates) > 0 {
-		tlsConf := &tls.Config{
-			Certificates:                g.conf.Certificates,
-			InsecureSkipVerify:          true,
-			DynamicRecordSizingDisabled: true,
+func (g *grayLogsWriter) sendWithRetry(ctx context.Context, entry logging.Entry) {
+	err := g.retry.Do(ctx, func() error {
+		err := g.send(entry.Fields)
+		if err != nil {
+			g.error(err, "error during sending log entry to graylog")
 		}
-
-		g.writer, err = graylog.NewGraylogTLS(endPoint, time.Second*time.Duration(g.conf.TimeOut), tlsConf)
-	} else {
-		g.logger.Warn("Missing graylog tls certificates, using unsafe tcp connection")
-		g.writer, err = graylog.NewGraylog(endPoint)
+		return err
+	})
+	if err != nil {
+		retry.Drop(g.conf.DeadLetter, []logging.Entry{entry}, err)
 	}
+}
+
+func (g *grayLogsWriter) send(fields []logging.LogField) error {
+	encoded, err := json.Marshal(g.prepareMessage(fields))
 	if err != nil {
-		g.writer = nil
-		return
+		return retry.Permanent(MessageError.Wrap(err))
 	}
 
-	return
+	return g.connection.send(encoded)
 }
 
-func (g *grayLogsWriter) start(timeOut int) {
-	go func(chanel chan []logging.LogField) {
-		for msg := range chanel {
-			for {
-				err := g.send(msg)
-				if err != nil {
-					g.logger.Error(err)
-					g.writer = nil
-
-					time.Sleep(time.Duration(timeOut) * time.Second)
-					if timeOut < 60 {
-						timeOut = timeOut * 2
-					}
-					continue
-				}
-
-				break
-			}
+// Print skips driver own entries so reporting of graylog errors never loops back into graylog
+func (g *grayLogsWriter) Print(_ string, fields []logging.LogField) {
+	for _, field := range fields {
+		if field.Name == SelfLogFieldKey {
+			return
 		}
-	}(g.chanel)
+	}
+
+	g.queue.Push(logging.Entry{Fields: fields})
 }
 
-func (g *grayLogsWriter) send(message []logging.LogField) (err error) {
-	for g.writer == nil {
-		err = g.connectToHost()
-		if err != nil {
-			return
-		}
+func (g *grayLogsWriter) Flush(ctx context.Context) error {
+	return g.queue.Flush(ctx)
+}
+
+func (g *grayLogsWriter) Close() error {
+	err := g.queue.Close()
+
+	if closeErr := g.connection.close(); closeErr != nil && err == nil {
+		err = closeErr
 	}
 
-	data, msg := g.prepareFields(message)
-	err = g.writer.Send(graylog.Message{
-		Version:      g.version,
-		Host:         g.host,
-		FullMessage:  data,
-		ShortMessage: msg,
-	})
+	return err
+}
 
-	return
+// Health reports connection state and the last delivery error
+func (g *grayLogsWriter) Health() Health {
+	return g.connection.state()
 }
 
-func (g *grayLogsWriter) Print(_ string, fields []logging.LogField) {
-	go func(chanel chan []logging.LogField, logFields []logging.LogField) {
-		chanel <- logFields
-	}(g.chanel, fields)
+// Healthy reports whether the last delivery attempt succeeded, it lets logging.NewFallbackPrinter
+// switch to local printer while graylog is unavailable
+func (g *grayLogsWriter) Healthy() bool {
+	return g.connection.isHealthy()
 }
 
-func (g *grayLogsWriter) prepareFields(fields []logging.LogField) (jsonData, insideMessage string) {
-	entry := make(map[string]interface{}, len(fields)+1)
-	for _, field := range fields {
-		entry[field.Name] = field.Value
-		if field.Name == logging.MessageFieldKey {
-			insideMessage = field.Value.(string)
-		}
+func (g *grayLogsWriter) Stats() logging.QueueStats {
+	return g.queue.Stats()
+}
+
+func (g *grayLogsWriter) prepareMessage(fields []logging.LogField) map[string]interface{} {
+	message := logging.GelfMessage(g.host, fields)
+	if g.version != "" {
+		message["version"] = g.version
+	}
+	if g.conf.ContainerName != "" {
+		message[containerNameField] = g.conf.ContainerName
+	}
+	if g.conf.Facility != "" {
+		message[facilityField] = g.conf.Facility
 	}
-	entry["container_name"] = "backend"
 
-	jsonLog, err := json.Marshal(entry)
-	if err != nil {
+	return message
+}
 
+func (g *grayLogsWriter) warn(message string) {
+	if g.logger != nil {
+		g.logger.Warn(message)
+		return
 	}
 
-	jsonData = string(jsonLog)
+	fmt.Println(fmt.Sprintf(`{"level":"WARNING","message":%q,"time":"%s"}`, message, time.Now().UTC().Format(time.RFC3339)))
+}
 
-	if insideMessage == "" {
-		insideMessage = "empty message"
+func (g *grayLogsWriter) error(err error, message string) {
+	if g.logger != nil {
+		g.logger.ErrorF(err, message)
+		return
 	}
 
-	return
+	fmt.Println(fmt.Sprintf(`{"error":%q,"message":%q,"time":"%s"}`, err.Error(), message, time.Now().UTC().Format(time.RFC3339)))
 }
@@ -0,0 +1,34 @@
+package gray_logs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"golibs/logging"
+)
+
+func TestPrintSkipsRedactedSelfLog(t *testing.T) {
+	var handled int32
+	queue, err := logging.NewQueue(logging.QueueConfig{}.WithDefaults(10, logging.OverflowDropNewest),
+		func(context.Context, logging.Entry) { atomic.AddInt32(&handled, 1) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &grayLogsWriter{queue: queue, connection: newConnection(Config{}, nil)}
+	defer g.Close()
+
+	redactor := logging.NewRedactor(logging.RedactionConfig{DenyByDefault: true})
+	g.Print("", redactor.Redact([]logging.LogField{
+		{Name: SelfLogFieldKey, Value: true},
+		{Name: logging.MessageFieldKey, Value: "send failed"},
+	}))
+	g.Print("", []logging.LogField{{Name: logging.MessageFieldKey, Value: "hello"}})
+
+	if err = g.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&handled); got != 1 {
+		t.Errorf("%d entries are queued, expected only application entry", got)
+	}
+}
@@ -1,12 +1,85 @@
 package gray_logs
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/external/log_drivers/tls_config"
+	"golibs/logging"
+)
 
 type Config struct {
-	Addr         string
-	Port         uint
-	TimeOut      int
-	Version      string
-	HostName     string
+	Addr     string
+	Port     uint
+	TimeOut  int
+	Version  string
+	HostName string
+	// ContainerName is sent as _container_name additional field, graylog shows it as container_name,
+	// defaults to "backend" as sent by earlier versions
+	ContainerName string
+	// Facility is sent as _facility additional field when set
+	Facility string
+	// Certificates are client certificates for mutual TLS, setting them enables TLS
 	Certificates []tls.Certificate
+	TLS          tls_config.Config
+	// Transport defaults to TCP, TLS config is used by TCP and HTTP transports
+	Transport Transport
+	// Compression is applied to UDP and HTTP messages, GELF TCP input accepts only uncompressed messages
+	Compression Compression
+	// ChunkSize limits UDP datagram size, larger messages are split into at most 128 chunks, defaults to 8192
+	ChunkSize  int
+	HttpPath   string
+	Queue      logging.QueueConfig
+	Retry      retry.Policy
+	DeadLetter retry.DeadLetter
+}
+
+// useTLS reports whether any TLS setting is present, partial settings like CAFile alone never fall back to plaintext
+func (c Config) useTLS() bool {
+	return c.TLS.IsSet() || len(c.Certificates) > 0
+}
+
+func (c Config) withDefaults() Config {
+	if c.Transport == "" {
+		c.Transport = TCP
+	}
+	if c.ContainerName == "" {
+		c.ContainerName = defaultContainerName
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = DefaultChunkSize
+	}
+	if c.HttpPath == "" {
+		c.HttpPath = DefaultHttpPath
+	}
+
+	return c
+}
+
+func (c Config) validate() error {
+	switch c.Transport {
+	case TCP:
+		if c.Compression != NoCompression {
+			return ConfigError.New("compression is not supported by TCP transport")
+		}
+	case UDP, HTTP:
+	default:
+		return ConfigError.NewF("unknown graylog transport %q, expected one of TCP, UDP, HTTP", string(c.Transport))
+	}
+
+	switch c.Compression {
+	case NoCompression, GzipCompression, ZlibCompression:
+	default:
+		return ConfigError.NewF("unknown graylog compression %q, expected one of GZIP, ZLIB", string(c.Compression))
+	}
+
+	if c.Transport == UDP && c.useTLS() {
+		return ConfigError.New("TLS is not supported by UDP transport")
+	}
+
+	if c.ChunkSize < minChunkSize || c.ChunkSize > DefaultChunkSize {
+		return ConfigError.NewF("chunk size must be between %d and %d, got %d", minChunkSize, DefaultChunkSize, c.ChunkSize)
+	}
+
+	return nil
 }
@@ -0,0 +1,34 @@
+package gray_logs
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"golibs/external/log_drivers/tls_config"
+)
+
+func TestConfigUseTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		tls      tls_config.Config
+		expected bool
+	}{
+		{"empty", tls_config.Config{}, false},
+		{"enabled", tls_config.Config{Enabled: true}, true},
+		{"ca file", tls_config.Config{CAFile: "ca.pem"}, true},
+		{"root cas", tls_config.Config{RootCAs: x509.NewCertPool()}, true},
+		{"server name", tls_config.Config{ServerName: "graylog"}, true},
+	}
+	for _, test := range tests {
+		if got := (Config{TLS: test.tls}).useTLS(); got != test.expected {
+			t.Errorf("%s: useTLS is %v, expected %v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestConfigRejectsUdpWithPartialTLS(t *testing.T) {
+	conf := Config{Transport: UDP, TLS: tls_config.Config{CAFile: "ca.pem"}}.withDefaults()
+	if err := conf.validate(); err == nil {
+		t.Error("UDP transport with CA file is accepted")
+	}
+}
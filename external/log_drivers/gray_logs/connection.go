@@ -0,0 +1,164 @@
+package gray_logs
+
+import (
+	"crypto/tls"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type State string
+
+const (
+	Disconnected State = "DISCONNECTED"
+	Connected    State = "CONNECTED"
+	Closed       State = "CLOSED"
+)
+
+// Health describes graylog connection state, LastError is kept until the next successful send
+type Health struct {
+	State         State
+	LastError     error
+	LastErrorTime time.Time
+	LastSendTime  time.Time
+	Reconnects    uint64
+}
+
+// connection owns graylog sender, every method is safe for concurrent use,
+// io serializes dialing and writes while mu guards only state so Health never waits for network
+type connection struct {
+	// healthy is 1 until send fails and again after successful send, it is read without locks
+	healthy int32
+	io      sync.Mutex
+	mu      sync.Mutex
+	conf    Config
+	tls     *tls.Config
+	writer  sender
+	health  Health
+}
+
+func newConnection(conf Config, tlsConf *tls.Config) *connection {
+	return &connection{
+		healthy: 1,
+		conf:    conf,
+		tls:     tlsConf,
+		health:  Health{State: Disconnected},
+	}
+}
+
+// connect opens sender unless connection is already established or closed
+func (c *connection) connect() error {
+	c.io.Lock()
+	defer c.io.Unlock()
+
+	_, err := c.open()
+	return err
+}
+
+// open returns current sender or dials a new one, caller holds io
+func (c *connection) open() (sender, error) {
+	c.mu.Lock()
+	state, writer := c.health.State, c.writer
+	c.mu.Unlock()
+
+	switch state {
+	case Connected:
+		return writer, nil
+	case Closed:
+		return nil, ConnectionError.New("graylog connection is closed")
+	}
+
+	writer, err := newSender(c.conf, c.tls)
+	if err != nil {
+		c.fail(nil, err)
+		return nil, ConnectionError.Wrap(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.health.State == Closed {
+		_ = writer.Close()
+		return nil, ConnectionError.New("graylog connection is closed")
+	}
+	if !c.health.LastSendTime.IsZero() || c.health.LastError != nil {
+		c.health.Reconnects++
+	}
+	c.writer = writer
+	c.health.State = Connected
+
+	return writer, nil
+}
+
+// send writes message reconnecting when needed, broken connection is closed and reopened on the next call
+func (c *connection) send(message []byte) error {
+	c.io.Lock()
+	defer c.io.Unlock()
+
+	writer, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	if err = writer.Send(message); err != nil {
+		c.fail(writer, err)
+		return err
+	}
+
+	c.mu.Lock()
+	c.health.LastError = nil
+	c.health.LastSendTime = time.Now()
+	c.mu.Unlock()
+	atomic.StoreInt32(&c.healthy, 1)
+
+	return nil
+}
+
+// fail records err and closes writer unless close has already taken it
+func (c *connection) fail(writer sender, err error) {
+	c.mu.Lock()
+	owned := writer != nil && c.writer == writer
+	if owned {
+		c.writer = nil
+	}
+	if c.health.State != Closed {
+		c.health.State = Disconnected
+	}
+	c.health.LastError = err
+	c.health.LastErrorTime = time.Now()
+	c.mu.Unlock()
+	atomic.StoreInt32(&c.healthy, 0)
+
+	if owned {
+		_ = writer.Close()
+	}
+}
+
+// close does not wait for send in progress, closing its writer interrupts it
+func (c *connection) close() error {
+	c.mu.Lock()
+	c.health.State = Closed
+	writer := c.writer
+	c.writer = nil
+	c.mu.Unlock()
+
+	if writer == nil {
+		return nil
+	}
+	if err := writer.Close(); err != nil {
+		return ConnectionError.Wrap(err)
+	}
+
+	return nil
+}
+
+func (c *connection) isHealthy() bool {
+	return atomic.LoadInt32(&c.healthy) == 1
+}
+
+func (c *connection) state() Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.health
+}
@@ -0,0 +1,74 @@
+package gray_logs
+
+import (
+	"testing"
+	"time"
+)
+
+// blockingSender blocks Send until release is closed
+type blockingSender struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSender) Send([]byte) error {
+	close(s.started)
+	<-s.release
+	return nil
+}
+
+func (s *blockingSender) Close() error {
+	return nil
+}
+
+func TestConnectionHealthDoesNotWaitForSend(t *testing.T) {
+	writer := &blockingSender{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(writer.release)
+
+	c := newConnection(Config{}, nil)
+	c.writer = writer
+	c.health.State = Connected
+
+	go func() { _ = c.send([]byte("{}")) }()
+	<-writer.started
+
+	done := make(chan Health, 1)
+	go func() { done <- c.state() }()
+
+	select {
+	case health := <-done:
+		if health.State != Connected {
+			t.Errorf("state is %s during send", health.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("state waits for send in progress")
+	}
+}
+
+type failingSender struct {
+	err error
+}
+
+func (s *failingSender) Send([]byte) error {
+	return s.err
+}
+
+func (s *failingSender) Close() error {
+	return nil
+}
+
+func TestConnectionHealthyRecoversAfterSend(t *testing.T) {
+	c := newConnection(Config{}, nil)
+	c.writer = &failingSender{err: ConnectionError.New("broken pipe")}
+	c.health.State = Connected
+
+	if err := c.send([]byte("{}")); err == nil || c.isHealthy() {
+		t.Fatalf("connection is healthy after failed send, error %v", err)
+	}
+
+	c.writer = &failingSender{}
+	c.health.State = Connected
+	if err := c.send([]byte("{}")); err != nil || !c.isHealthy() {
+		t.Errorf("connection is not healthy after successful send, error %v", err)
+	}
+}
@@ -2,4 +2,8 @@ package gray_logs
 
 import "golibs/errors"
 
-var ConnectionError = errors.NewWrapper("connection error")
+var (
+	ConnectionError = errors.NewWrapper("connection error")
+	ConfigError     = errors.NewWrapper("invalid graylog config", errors.ValidationErrorType)
+	MessageError    = errors.NewWrapper("invalid gelf message")
+)
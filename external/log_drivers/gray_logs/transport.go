@@ -0,0 +1,280 @@
+package gray_logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/external/log_drivers/tls_config"
+)
+
+type Transport string
+
+const (
+	TCP  Transport = "TCP"
+	UDP  Transport = "UDP"
+	HTTP Transport = "HTTP"
+)
+
+type Compression string
+
+const (
+	NoCompression   Compression = ""
+	GzipCompression Compression = "GZIP"
+	ZlibCompression Compression = "ZLIB"
+)
+
+const (
+	// DefaultChunkSize is the maximal UDP datagram size accepted by graylog
+	DefaultChunkSize = 8192
+	// MaxChunks is the maximal number of chunks for single GELF message
+	MaxChunks = 128
+	// DefaultHttpPath is the path of graylog GELF HTTP input
+	DefaultHttpPath = "/gelf"
+
+	chunkHeaderSize  = 12
+	minChunkSize     = chunkHeaderSize + 1
+	maxErrorBodySize = 512
+	defaultTimeOut   = 10
+)
+
+var chunkMagic = []byte{0x1e, 0x0f}
+
+type sender interface {
+	Send(message []byte) error
+	Close() error
+}
+
+// newSender opens connection, tlsConf is nil for plain connections
+func newSender(conf Config, tlsConf *tls.Config) (sender, error) {
+	address := fmt.Sprintf("%s:%d", conf.Addr, conf.Port)
+
+	switch conf.Transport {
+	case TCP:
+		return newTcpSender(address, conf, tlsConf)
+	case UDP:
+		return newUdpSender(address, conf)
+	case HTTP:
+		return newHttpSender(address, conf, tlsConf), nil
+	}
+
+	return nil, ConfigError.NewF("unknown graylog transport %q", string(conf.Transport))
+}
+
+// tcpSender writes null byte delimited messages, GELF TCP input does not support compression
+type tcpSender struct {
+	conn    net.Conn
+	timeOut time.Duration
+}
+
+func newTcpSender(address string, conf Config, tlsConf *tls.Config) (*tcpSender, error) {
+	dialer := &net.Dialer{Timeout: timeOut(conf)}
+
+	if tlsConf == nil {
+		conn, err := dialer.Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpSender{conn: conn, timeOut: dialer.Timeout}, nil
+	}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tcpSender{conn: conn, timeOut: dialer.Timeout}, nil
+}
+
+// Send fails after timeout when graylog stops reading, so stalled peer does not hang the queue
+func (s *tcpSender) Send(message []byte) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.timeOut)); err != nil {
+		return err
+	}
+
+	data := make([]byte, len(message)+1)
+	copy(data, message)
+	_, err := s.conn.Write(data)
+	return err
+}
+
+func (s *tcpSender) Close() error {
+	return s.conn.Close()
+}
+
+// udpSender splits messages larger than chunk size into GELF chunks
+type udpSender struct {
+	conn        net.Conn
+	chunkSize   int
+	compression Compression
+}
+
+func newUdpSender(address string, conf Config) (*udpSender, error) {
+	conn, err := net.DialTimeout("udp", address, timeOut(conf))
+	if err != nil {
+		return nil, err
+	}
+
+	return &udpSender{
+		conn:        conn,
+		chunkSize:   conf.ChunkSize,
+		compression: conf.Compression,
+	}, nil
+}
+
+func (s *udpSender) Send(message []byte) error {
+	data, err := compress(message, s.compression)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+
+	if len(data) <= s.chunkSize {
+		_, err = s.conn.Write(data)
+		return err
+	}
+
+	payloadSize := s.chunkSize - chunkHeaderSize
+	count := (len(data) + payloadSize - 1) / payloadSize
+	if count > MaxChunks {
+		return retry.Permanent(MessageError.NewF("message of %d bytes needs %d chunks, graylog accepts at most %d", len(data), count, MaxChunks))
+	}
+
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 0, s.chunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payloadSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk = append(chunk[:0], chunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data[i*payloadSize:end]...)
+		if _, err = s.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *udpSender) Close() error {
+	return s.conn.Close()
+}
+
+// httpSender posts messages to GELF HTTP input, https is used when TLS is enabled
+type httpSender struct {
+	url         string
+	client      *http.Client
+	compression Compression
+}
+
+func newHttpSender(address string, conf Config, tlsConf *tls.Config) *httpSender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	scheme := "http"
+	if tlsConf != nil {
+		scheme = "https"
+		transport.TLSClientConfig = tlsConf
+	}
+
+	return &httpSender{
+		url:         scheme + "://" + address + conf.HttpPath,
+		client:      &http.Client{Transport: transport, Timeout: timeOut(conf)},
+		compression: conf.Compression,
+	}
+}
+
+func (s *httpSender) Send(message []byte) error {
+	data, err := compress(message, s.compression)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	switch s.compression {
+	case GzipCompression:
+		request.Header.Set("Content-Encoding", "gzip")
+	case ZlibCompression:
+		request.Header.Set("Content-Encoding", "deflate")
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return retry.StatusError(response.StatusCode, string(body))
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+
+	return nil
+}
+
+func (s *httpSender) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func compress(message []byte, compression Compression) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+
+	switch compression {
+	case NoCompression:
+		return message, nil
+	case GzipCompression:
+		writer = gzip.NewWriter(&buffer)
+	case ZlibCompression:
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return nil, ConfigError.NewF("unknown graylog compression %q", string(compression))
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func newTLSConfig(conf Config) (*tls.Config, error) {
+	if !conf.useTLS() {
+		return nil, nil
+	}
+
+	tlsConf := conf.TLS
+	tlsConf.Certificates = append(append([]tls.Certificate(nil), conf.Certificates...), conf.TLS.Certificates...)
+	return tls_config.New(tlsConf, conf.Addr)
+}
+
+func timeOut(conf Config) time.Duration {
+	if conf.TimeOut <= 0 {
+		return time.Second * defaultTimeOut
+	}
+
+	return time.Second * time.Duration(conf.TimeOut)
+}
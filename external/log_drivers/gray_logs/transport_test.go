@@ -0,0 +1,261 @@
+package gray_logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golibs/external/log_drivers/retry"
+)
+
+func listenUdp(t *testing.T) (*net.UDPConn, Config) {
+	t.Helper()
+
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	addr := listener.LocalAddr().(*net.UDPAddr)
+	conf := Config{Addr: "127.0.0.1", Port: uint(addr.Port), Transport: UDP}.withDefaults()
+	return listener, conf
+}
+
+// readGelf reads datagrams until the whole message is received and reassembles chunks by sequence number
+func readGelf(t *testing.T, listener *net.UDPConn) (data []byte, datagrams int) {
+	t.Helper()
+
+	var chunks [][]byte
+	buf := make([]byte, 65536)
+	for {
+		if err := listener.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := listener.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		datagrams++
+		datagram := append([]byte(nil), buf[:n]...)
+
+		if !bytes.HasPrefix(datagram, chunkMagic) {
+			return datagram, datagrams
+		}
+
+		seq, count := int(datagram[10]), int(datagram[11])
+		if chunks == nil {
+			chunks = make([][]byte, count)
+		}
+		chunks[seq] = datagram[chunkHeaderSize:]
+
+		complete := true
+		for _, chunk := range chunks {
+			complete = complete && chunk != nil
+		}
+		if complete {
+			return bytes.Join(chunks, nil), datagrams
+		}
+	}
+}
+
+func decompress(t *testing.T, data []byte, compression Compression) string {
+	t.Helper()
+
+	var reader io.Reader = bytes.NewReader(data)
+	var err error
+	switch compression {
+	case GzipCompression:
+		reader, err = gzip.NewReader(reader)
+	case ZlibCompression:
+		reader, err = zlib.NewReader(reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(result)
+}
+
+func TestUdpSenderChunking(t *testing.T) {
+	// random looking payload so compressed message still needs several chunks
+	var builder strings.Builder
+	for i := 0; builder.Len() < 20000; i++ {
+		builder.WriteString(time.Duration(i * 7919).String())
+	}
+	message := `{"short_message":"` + builder.String() + `"}`
+
+	for _, compression := range []Compression{NoCompression, GzipCompression, ZlibCompression} {
+		t.Run(string(compression), func(t *testing.T) {
+			listener, conf := listenUdp(t)
+			conf.Compression = compression
+			conf.ChunkSize = 1024
+
+			sender, err := newUdpSender(listener.LocalAddr().String(), conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sender.Close()
+
+			if err = sender.Send([]byte(message)); err != nil {
+				t.Fatal(err)
+			}
+
+			data, datagrams := readGelf(t, listener)
+			if datagrams < 2 {
+				t.Errorf("message is sent in %d datagram, expected chunks", datagrams)
+			}
+			if got := decompress(t, data, compression); got != message {
+				t.Errorf("received message of %d bytes differs from sent one of %d bytes", len(got), len(message))
+			}
+		})
+	}
+}
+
+func TestUdpSenderSmallMessage(t *testing.T) {
+	listener, conf := listenUdp(t)
+	sender, err := newUdpSender(listener.LocalAddr().String(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	if err = sender.Send([]byte(`{"short_message":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, datagrams := readGelf(t, listener)
+	if datagrams != 1 || string(data) != `{"short_message":"hi"}` {
+		t.Errorf("received %q in %d datagrams", data, datagrams)
+	}
+}
+
+func TestUdpSenderTooManyChunks(t *testing.T) {
+	listener, conf := listenUdp(t)
+	conf.ChunkSize = minChunkSize
+
+	sender, err := newUdpSender(listener.LocalAddr().String(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	err = sender.Send(bytes.Repeat([]byte("x"), MaxChunks+1))
+	if !retry.IsPermanent(err) {
+		t.Errorf("expected permanent error, got %v", err)
+	}
+}
+
+func TestTcpSenderDelimitsMessages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			message, err := reader.ReadString(0)
+			if err != nil {
+				return
+			}
+			received <- strings.TrimSuffix(message, "\x00")
+		}
+	}()
+
+	sender, err := newTcpSender(listener.Addr().String(), Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// spare capacity of caller buffer holds sentinel which must survive sending
+	buffer := append(make([]byte, 0, 64), `{"a":1}Z`...)
+	if err = sender.Send(buffer[:7]); err != nil {
+		t.Fatal(err)
+	}
+	if buffer[7] != 'Z' {
+		t.Error("delimiter is written into caller buffer")
+	}
+	if err = sender.Send([]byte(`{"b":2}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{`{"a":1}`, `{"b":2}`} {
+		select {
+		case message := <-received:
+			if message != expected {
+				t.Errorf("received %q, expected %q", message, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("message is not received")
+		}
+	}
+}
+
+func TestTcpSenderWriteDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// peer accepts connection but never reads, so socket buffers fill up
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	sender, err := newTcpSender(listener.Addr().String(), Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	sender.timeOut = 100 * time.Millisecond
+
+	conn := <-accepted
+	defer conn.Close()
+
+	message := bytes.Repeat([]byte("x"), 1<<20)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			if err := sender.Send(message); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err = <-done:
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("send to stalled peer does not time out")
+	}
+}
@@ -2,163 +2,224 @@ package loki
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
+	"golibs/external/log_drivers/retry"
 	"golibs/logging"
-	"golibs/models"
 )
 
+const (
+	defaultQueueCapacity = 1000
+	defaultBatchEntries  = 500
+	defaultBatchWait     = time.Second
+	defaultBatchBytes    = 1 << 20
+	maxErrorBodySize     = 512
+)
+
+// NewLoki panics when printer can not be created from conf, use New to handle the error
 func NewLoki(conf Config) *loki {
-	client := http.DefaultClient
-	client.Timeout = time.Second * time.Duration(conf.TimeOutSec)
-
-	chanel := make(chan []logging.LogField, 100)
-	lk := loki{
-		url:           conf.Url,
-		containerName: conf.ContainerName,
-		client:        http.Client{},
-		chanel:        chanel,
+	lk, err := New(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	return lk
+}
+
+func New(conf Config) (*loki, error) {
+	client, err := newHttpClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	formatter := conf.Formatter
+	if formatter == nil {
+		formatter = logging.NewJsonFormatter()
+	}
+
+	pushFormat := conf.PushFormat
+	switch pushFormat {
+	case "":
+		pushFormat = JsonPushFormat
+	case JsonPushFormat, ProtobufPushFormat:
+	default:
+		return nil, ConfigError.NewF("unknown loki push format %q, expected one of JSON, PROTOBUF", string(pushFormat))
+	}
+
+	batchBytes := conf.BatchMaxBytes
+	if batchBytes <= 0 {
+		batchBytes = defaultBatchBytes
 	}
 
-	lk.start()
+	lk := &loki{
+		formatter:  formatter,
+		url:        conf.Url,
+		labels:     newLabelPolicy(conf),
+		client:     client,
+		pushFormat: pushFormat,
+		gzip:       conf.Gzip,
+		batchBytes: batchBytes,
+		retry:      conf.Retry.WithDefaults(),
+		deadLetter: conf.DeadLetter,
+
+		tenantID:          conf.TenantID,
+		basicAuthUser:     conf.BasicAuthUser,
+		basicAuthPassword: conf.BasicAuthPassword,
+		bearerToken:       conf.BearerToken,
+		headers:           conf.Headers,
+	}
 
-	return &lk
+	queue, err := logging.NewBatchQueue(
+		conf.Queue.WithDefaults(defaultQueueCapacity, logging.OverflowDropNewest),
+		conf.Batch.WithDefaults(defaultBatchEntries, defaultBatchWait),
+		lk.sendBatch,
+	)
+	if err != nil {
+		return nil, err
+	}
+	lk.queue = queue
+
+	return lk, nil
 }
 
 type loki struct {
-	url           string
-	containerName string
-	client        http.Client
-	chanel        chan []logging.LogField
+	url        string
+	labels     labelPolicy
+	client     *http.Client
+	queue      *logging.Queue
+	formatter  logging.Formatter
+	pushFormat PushFormat
+	gzip       bool
+	batchBytes int
+	retry      retry.Policy
+	deadLetter retry.DeadLetter
+	health     retry.Health
+
+	tenantID          string
+	basicAuthUser     string
+	basicAuthPassword string
+	bearerToken       string
+	headers           map[string]string
 }
 
 func (l *loki) Print(_ string, fields []logging.LogField) {
-	go func(chanel chan []logging.LogField, fields []logging.LogField) {
-		chanel <- fields
-	}(l.chanel, fields)
+	l.queue.Push(logging.Entry{Fields: fields})
 }
 
-func (l *loki) start() {
-	go func(chanel chan []logging.LogField) {
-		for logs := range chanel {
-			timeout := 1
-			for {
-				err := l.send(logs)
-				if err != nil {
-					time.Sleep(time.Duration(timeout) * time.Second)
-					if timeout < 60 {
-						timeout = timeout * 2
-					}
-					continue
-				}
-
-				break
-			}
-		}
-	}(l.chanel)
+func (l *loki) Flush(ctx context.Context) error {
+	return l.queue.Flush(ctx)
 }
 
-func (l *loki) send(fields []logging.LogField) (err error) {
-	logFields := make(map[string]interface{}, len(fields))
-	var level, ts, message, method, path, statusCode, responseStatus, latency, requestId, errorMsg, responseError, requesterAddr string
-	for _, field := range fields {
-		switch field.Name {
-		case logging.LogLvlFieldKey:
-			level = strings.ToLower(strings.Replace(field.Value.(string), `"`, `'`, -1))
-		case logging.MessageFieldKey:
-			message = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.MethodFieldKey:
-			method = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.PathLogKey:
-			path = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.StatusCodeFieldKey:
-			statusCode = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.ResponseFieldKey:
-			if response, ok := field.Value.(models.Response); ok {
-				responseStatus = strings.Replace(response.Status, `"`, `'`, -1)
-				responseError = strings.Replace(response.ErrorCode, `"`, `'`, -1)
-			}
-		case logging.LatencyFieldKey:
-			latency = strconv.FormatFloat(field.Value.(float64), 'f', -1, 64)
-		case logging.RequestIdFieldKey:
-			requestId = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.ErrorFieldKey:
-			errorMsg = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.RemoteAddressFieldKey:
-			requesterAddr = strings.Replace(field.Value.(string), `"`, `'`, -1)
-		case logging.TimeFieldKey:
-			ts = strings.Replace(field.Value.(string), `"`, `'`, -1)
+func (l *loki) Close() error {
+	return l.queue.Close()
+}
+
+func (l *loki) Stats() logging.QueueStats {
+	return l.queue.Stats()
+}
+
+// Healthy reports whether the last push reached loki, logging.NewFallbackPrinter uses it to switch printers
+func (l *loki) Healthy() bool {
+	return l.health.Healthy()
+}
+
+// sendBatch groups entries into streams by label set and pushes them in chunks limited by batchBytes
+func (l *loki) sendBatch(ctx context.Context, entries []logging.Entry) {
+	var streams []*pushStream
+	streamsByKey := map[string]*pushStream{}
+	size, chunkStart := 0, 0
+
+	for i, entry := range entries {
+		labels, lineFields, metadata := l.labels.split(entry.Fields)
+		line := pushEntry{
+			ts:       logging.EntryTime(entry.Fields),
+			line:     l.formatter.Format(lineFields),
+			metadata: metadata,
 		}
 
-		logFields[field.Name] = field.Value
-	}
+		if size > 0 && size+len(line.line) > l.batchBytes {
+			l.sendWithRetry(ctx, streams, entries[chunkStart:i])
+			streams, streamsByKey, size, chunkStart = nil, map[string]*pushStream{}, 0, i
+		}
 
-	labels := map[string]string{
-		"container_name":              l.containerName,
-		logging.LogLvlFieldKey:        level,
-		logging.MessageFieldKey:       message,
-		logging.MethodFieldKey:        method,
-		logging.PathLogKey:            path,
-		logging.StatusCodeFieldKey:    statusCode,
-		logging.ResponseFieldKey:      responseStatus,
-		logging.LatencyFieldKey:       latency,
-		logging.RequestIdFieldKey:     requestId,
-		logging.ErrorFieldKey:         errorMsg,
-		logging.ResponseErrorFieldKey: responseError,
-		logging.RemoteAddressFieldKey: requesterAddr,
-		logging.TimeFieldKey:          ts,
+		key := labelsString(labels)
+		s, ok := streamsByKey[key]
+		if !ok {
+			s = &pushStream{labels: labels, key: key}
+			streamsByKey[key] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, line)
+		size += len(line.line)
 	}
 
-	jsonFields, err := json.Marshal(logFields)
-	if err != nil {
-		fmt.Println(fmt.Sprintf(
-			`{"error":"%s","message":"error during marshaling log fields for loki request","time":"%s"}`,
-			err.Error(), time.Now().UTC().Format(time.RFC3339)),
-		)
-		err = nil
-		return
+	if len(streams) > 0 {
+		l.sendWithRetry(ctx, streams, entries[chunkStart:])
 	}
+}
 
-	data := dto{
-		Streams: []stream{
-			{
-				Stream: labels,
-				Values: [][]string{
-					{
-						strconv.FormatInt(time.Now().UnixNano(), 10),
-						string(jsonFields),
-					},
-				},
-			},
-		},
+func (l *loki) sendWithRetry(ctx context.Context, streams []*pushStream, entries []logging.Entry) {
+	err := l.retry.Do(ctx, func() error {
+		return l.health.Record(l.send(ctx, streams))
+	})
+	if err != nil {
+		retry.Drop(l.deadLetter, entries, err)
 	}
+}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		fmt.Println(fmt.Sprintf(
-			`{"error":"%s","message":"error during marshaling loki request","time":"%s"}`,
-			err.Error(), time.Now().UTC().Format(time.RFC3339)),
-		)
-		err = nil
-		return
+func (l *loki) send(ctx context.Context, streams []*pushStream) (err error) {
+	var body []byte
+	var contentType, contentEncoding string
+	switch l.pushFormat {
+	case ProtobufPushFormat:
+		body = snappyEncode(encodeProtobufPush(streams))
+		contentType = "application/x-protobuf"
+	default:
+		body, err = encodeJsonPush(streams)
+		if err != nil {
+			fmt.Println(fmt.Sprintf(
+				`{"error":"%s","message":"error during marshaling loki request","time":"%s"}`,
+				err.Error(), time.Now().UTC().Format(time.RFC3339)),
+			)
+			err = retry.Permanent(err)
+			return
+		}
+		contentType = "application/json"
+
+		if l.gzip {
+			body, err = gzipEncode(body)
+			if err != nil {
+				fmt.Println(fmt.Sprintf(
+					`{"error":"%s","message":"error during compressing loki request","time":"%s"}`,
+					err.Error(), time.Now().UTC().Format(time.RFC3339)),
+				)
+				err = retry.Permanent(err)
+				return
+			}
+			contentEncoding = "gzip"
+		}
 	}
 
-	request, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(jsonData))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
 	if err != nil {
 		fmt.Println(fmt.Sprintf(
 			`{"error":"%s","message":"error during building loki request","time":"%s"}`,
 			err.Error(), time.Now().UTC().Format(time.RFC3339)),
 		)
-		err = nil
+		err = retry.Permanent(err)
 		return
 	}
 
-	request.Header.Set("content-type", "application/json")
+	l.setHeaders(request)
+	request.Header.Set("content-type", contentType)
+	if contentEncoding != "" {
+		request.Header.Set("content-encoding", contentEncoding)
+	}
 
 	response, err := l.client.Do(request)
 	if err != nil {
@@ -168,23 +229,17 @@ func (l *loki) send(fields []logging.LogField) (err error) {
 		)
 		return
 	}
+	defer response.Body.Close()
 
-	if response.StatusCode != 204 {
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
 		fmt.Println(fmt.Sprintf(
-			`{"error":"http status error during sending logs to loki, status: %d","time":"%s"`,
+			`{"error":"http status error during sending logs to loki, status: %d","time":"%s"}`,
 			response.StatusCode, time.Now().UTC().Format(time.RFC3339)),
 		)
+		err = retry.StatusError(response.StatusCode, string(body))
 		return
 	}
 
 	return
 }
-
-type dto struct {
-	Streams []stream `json:"streams"`
-}
-
-type stream struct {
-	Stream map[string]string `json:"stream"`
-	Values [][]string        `json:"values"`
-}
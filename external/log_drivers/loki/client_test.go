@@ -0,0 +1,456 @@
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/logging"
+)
+
+type testStream struct {
+	labels   string
+	lines    []string
+	metadata []map[string]string
+}
+
+type testPush struct {
+	header  http.Header
+	streams []testStream
+}
+
+// pushServer decodes JSON and snappy compressed protobuf push requests
+type pushServer struct {
+	mu     sync.Mutex
+	pushes []testPush
+}
+
+func (s *pushServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil && r.Header.Get("content-encoding") == "gzip" {
+		body, err = gunzip(body)
+	}
+
+	var streams []testStream
+	if err == nil {
+		switch r.Header.Get("content-type") {
+		case "application/x-protobuf":
+			streams, err = decodeTestProtobuf(body)
+		default:
+			streams, err = decodeTestJson(body)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.pushes = append(s.pushes, testPush{header: r.Header, streams: streams})
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *pushServer) received() []testPush {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]testPush(nil), s.pushes...)
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(reader)
+}
+
+func decodeTestJson(body []byte) ([]testStream, error) {
+	var data struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	var streams []testStream
+	for _, s := range data.Streams {
+		stream := testStream{labels: labelsString(s.Stream)}
+		for _, value := range s.Values {
+			var ts, line string
+			if err := json.Unmarshal(value[0], &ts); err != nil {
+				return nil, err
+			}
+			if _, err := strconv.ParseInt(ts, 10, 64); err != nil {
+				return nil, fmt.Errorf("timestamp %q is not unix nanoseconds", ts)
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, err
+			}
+			var metadata map[string]string
+			if len(value) > 2 {
+				if err := json.Unmarshal(value[2], &metadata); err != nil {
+					return nil, err
+				}
+			}
+			stream.lines = append(stream.lines, line)
+			stream.metadata = append(stream.metadata, metadata)
+		}
+		streams = append(streams, stream)
+	}
+
+	return streams, nil
+}
+
+func decodeTestProtobuf(body []byte) ([]testStream, error) {
+	data, err := snappyDecode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []testStream
+	for _, streamData := range protoFields(data)[1] {
+		fields := protoFields(streamData)
+		stream := testStream{labels: string(fields[1][0])}
+		for _, entryData := range fields[2] {
+			entry := protoFields(entryData)
+			if len(entry[1]) != 1 {
+				return nil, fmt.Errorf("entry has no timestamp")
+			}
+			var metadata map[string]string
+			for _, pairData := range entry[3] {
+				pair := protoFields(pairData)
+				if metadata == nil {
+					metadata = map[string]string{}
+				}
+				metadata[string(pair[1][0])] = string(pair[2][0])
+			}
+			stream.lines = append(stream.lines, string(entry[2][0]))
+			stream.metadata = append(stream.metadata, metadata)
+		}
+		streams = append(streams, stream)
+	}
+
+	return streams, nil
+}
+
+// protoFields returns length delimited fields of message by field number, varint fields are skipped
+func protoFields(data []byte) map[int][][]byte {
+	fields := map[int][][]byte{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		if key&7 == 0 {
+			_, n = binary.Uvarint(data)
+			data = data[n:]
+			continue
+		}
+		size, n := binary.Uvarint(data)
+		data = data[n:]
+		fields[int(key>>3)] = append(fields[int(key>>3)], data[:size])
+		data = data[size:]
+	}
+
+	return fields
+}
+
+// snappyDecode supports literal and two byte offset copy tags written by snappyEncode
+func snappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	src = src[n:]
+	dst := make([]byte, 0, size)
+
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case snappyTagLiteral:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				bytes := length - 59
+				length = 0
+				for i := 0; i < bytes; i++ {
+					length |= int(src[i]) << (8 * i)
+				}
+				src = src[bytes:]
+			}
+			length++
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+		case snappyTagCopy2:
+			length := int(tag>>2) + 1
+			offset := int(src[1]) | int(src[2])<<8
+			src = src[3:]
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		default:
+			return nil, fmt.Errorf("unexpected snappy tag %d", tag&3)
+		}
+	}
+
+	if uint64(len(dst)) != size {
+		return nil, fmt.Errorf("decoded %d bytes, expected %d", len(dst), size)
+	}
+
+	return dst, nil
+}
+
+func newTestLoki(t *testing.T, server *pushServer, conf Config) *loki {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	conf.Url = httpServer.URL
+	if conf.Batch.MaxWait == 0 {
+		conf.Batch.MaxWait = 10 * time.Millisecond
+	}
+	lk, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lk.Close() })
+
+	return lk
+}
+
+func flushLoki(t *testing.T, lk *loki) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lk.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func printLevel(lk *loki, level, message string) {
+	lk.Print("", []logging.LogField{
+		{Name: logging.LogLvlFieldKey, Value: level},
+		{Name: logging.MessageFieldKey, Value: message},
+	})
+}
+
+func TestLokiGroupsEntriesByLabelSet(t *testing.T) {
+	for _, format := range []PushFormat{JsonPushFormat, ProtobufPushFormat} {
+		t.Run(string(format), func(t *testing.T) {
+			server := &pushServer{}
+			lk := newTestLoki(t, server, Config{ContainerName: "app", PushFormat: format, Batch: logging.BatchConfig{MaxWait: 100 * time.Millisecond}})
+
+			printLevel(lk, "INFO", "first")
+			printLevel(lk, "ERROR", "failed")
+			printLevel(lk, "INFO", "second")
+			flushLoki(t, lk)
+
+			pushes := server.received()
+			if len(pushes) != 1 {
+				t.Fatalf("%d pushes are sent, expected single batch", len(pushes))
+			}
+			streams := pushes[0].streams
+			if len(streams) != 2 {
+				t.Fatalf("entries are pushed in %d streams, expected 2", len(streams))
+			}
+			if streams[0].labels != `{container_name="app", level="info"}` || len(streams[0].lines) != 2 {
+				t.Errorf("first stream %s has %d lines, expected info stream with 2 lines", streams[0].labels, len(streams[0].lines))
+			}
+			if streams[1].labels != `{container_name="app", level="error"}` || len(streams[1].lines) != 1 {
+				t.Errorf("second stream %s has %d lines, expected error stream with 1 line", streams[1].labels, len(streams[1].lines))
+			}
+
+			var line map[string]interface{}
+			if err := json.Unmarshal([]byte(streams[0].lines[1]), &line); err != nil {
+				t.Fatal(err)
+			}
+			if line[logging.MessageFieldKey] != "second" {
+				t.Errorf("line %v is not the second info entry", line)
+			}
+		})
+	}
+}
+
+func TestLokiPushesStructuredMetadata(t *testing.T) {
+	for _, format := range []PushFormat{JsonPushFormat, ProtobufPushFormat} {
+		t.Run(string(format), func(t *testing.T) {
+			server := &pushServer{}
+			lk := newTestLoki(t, server, Config{PushFormat: format, StructuredMetadataFields: []string{logging.RequestIdFieldKey}})
+
+			lk.Print("", []logging.LogField{
+				{Name: logging.MessageFieldKey, Value: "handled"},
+				{Name: logging.RequestIdFieldKey, Value: "r-1"},
+			})
+			flushLoki(t, lk)
+
+			pushes := server.received()
+			if len(pushes) != 1 || len(pushes[0].streams) != 1 {
+				t.Fatalf("pushes %+v, expected single stream", pushes)
+			}
+			stream := pushes[0].streams[0]
+			if stream.metadata[0][logging.RequestIdFieldKey] != "r-1" {
+				t.Errorf("entry metadata is %v, expected request id", stream.metadata[0])
+			}
+			if line := stream.lines[0]; line != `{"message":"handled"}` {
+				t.Errorf("line %s contains structured metadata field", line)
+			}
+		})
+	}
+}
+
+func TestLokiBatchMaxEntries(t *testing.T) {
+	server := &pushServer{}
+	lk := newTestLoki(t, server, Config{Batch: logging.BatchConfig{MaxEntries: 2, MaxWait: 50 * time.Millisecond}})
+
+	for i := 0; i < 3; i++ {
+		printLevel(lk, "INFO", fmt.Sprint(i))
+	}
+	flushLoki(t, lk)
+
+	pushes := server.received()
+	if len(pushes) != 2 {
+		t.Fatalf("%d pushes are sent, expected 2", len(pushes))
+	}
+	if first, second := len(pushes[0].streams[0].lines), len(pushes[1].streams[0].lines); first != 2 || second != 1 {
+		t.Errorf("pushes have %d and %d lines, expected 2 and 1", first, second)
+	}
+}
+
+func TestLokiBatchMaxBytes(t *testing.T) {
+	server := &pushServer{}
+	lk := newTestLoki(t, server, Config{BatchMaxBytes: 1, Batch: logging.BatchConfig{MaxWait: 100 * time.Millisecond}})
+
+	for i := 0; i < 3; i++ {
+		printLevel(lk, "INFO", fmt.Sprint(i))
+	}
+	flushLoki(t, lk)
+
+	if pushes := server.received(); len(pushes) != 3 {
+		t.Errorf("%d pushes are sent, expected every line above byte limit in its own push", len(pushes))
+	}
+}
+
+func TestLokiBatchMaxWait(t *testing.T) {
+	server := &pushServer{}
+	lk := newTestLoki(t, server, Config{Batch: logging.BatchConfig{MaxEntries: 100, MaxWait: 20 * time.Millisecond}})
+
+	printLevel(lk, "INFO", "single")
+
+	deadline := time.Now().Add(time.Second)
+	for len(server.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("incomplete batch is not pushed after max wait")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLokiGzip(t *testing.T) {
+	server := &pushServer{}
+	lk := newTestLoki(t, server, Config{Gzip: true})
+
+	printLevel(lk, "INFO", "compressed")
+	flushLoki(t, lk)
+
+	pushes := server.received()
+	if len(pushes) != 1 {
+		t.Fatalf("%d pushes are sent, expected 1", len(pushes))
+	}
+	if encoding := pushes[0].header.Get("content-encoding"); encoding != "gzip" {
+		t.Errorf("content encoding is %q, expected gzip", encoding)
+	}
+	if len(pushes[0].streams) != 1 {
+		t.Errorf("gzip body has %d streams, expected 1", len(pushes[0].streams))
+	}
+}
+
+func TestLokiHeaders(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		conf          Config
+		authorization string
+	}{
+		{
+			name:          "basic auth",
+			conf:          Config{TenantID: "tenant", BasicAuthUser: "user", BasicAuthPassword: "secret", Headers: map[string]string{"X-Custom": "value"}},
+			authorization: "Basic dXNlcjpzZWNyZXQ=",
+		},
+		{
+			name:          "bearer token",
+			conf:          Config{TenantID: "tenant", BasicAuthUser: "user", BearerToken: "token", Headers: map[string]string{"X-Custom": "value"}},
+			authorization: "Bearer token",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := &pushServer{}
+			lk := newTestLoki(t, server, test.conf)
+
+			printLevel(lk, "INFO", "authorized")
+			flushLoki(t, lk)
+
+			pushes := server.received()
+			if len(pushes) != 1 {
+				t.Fatalf("%d pushes are sent, expected 1", len(pushes))
+			}
+			header := pushes[0].header
+			if tenant := header.Get(tenantHeader); tenant != "tenant" {
+				t.Errorf("tenant header is %q", tenant)
+			}
+			if authorization := header.Get("Authorization"); authorization != test.authorization {
+				t.Errorf("authorization header is %q, expected %q", authorization, test.authorization)
+			}
+			if custom := header.Get("X-Custom"); custom != "value" {
+				t.Errorf("custom header is %q", custom)
+			}
+		})
+	}
+}
+
+func TestLokiHealthyFollowsPushOutcome(t *testing.T) {
+	var status int32 = http.StatusServiceUnavailable
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer httpServer.Close()
+
+	lk, err := New(Config{
+		Url:        httpServer.URL,
+		Batch:      logging.BatchConfig{MaxWait: time.Millisecond},
+		Retry:      retry.Policy{MaxAttempts: 1},
+		DeadLetter: retry.DeadLetterFunc(func([]logging.Entry, error) {}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lk.Close()
+
+	if !lk.Healthy() {
+		t.Fatal("loki is unhealthy before the first push")
+	}
+
+	printLevel(lk, "INFO", "unavailable")
+	flushLoki(t, lk)
+	if lk.Healthy() {
+		t.Error("loki is healthy after failed push")
+	}
+
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	printLevel(lk, "INFO", "delivered")
+	flushLoki(t, lk)
+	if !lk.Healthy() {
+		t.Error("loki is unhealthy after successful push")
+	}
+}
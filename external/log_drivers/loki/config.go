@@ -1,7 +1,41 @@
 package loki
 
+import (
+	"golibs/external/log_drivers/retry"
+	"golibs/external/log_drivers/tls_config"
+	"golibs/logging"
+)
+
+// Config is loki printer configuration, zero values are replaced with defaults
 type Config struct {
 	ContainerName string
 	Url           string
 	TimeOutSec    int
+	StaticLabels  map[string]string
+	// LabelFields are low cardinality log fields used as stream labels, DefaultLabelFields are used when empty,
+	// every field is kept in the log line as well
+	LabelFields              []string
+	StructuredMetadataFields []string
+	Formatter                logging.Formatter
+	Queue                    logging.QueueConfig
+	Batch                    logging.BatchConfig
+	// BatchMaxBytes limits log lines size of single push, defaults to 1MB
+	BatchMaxBytes int
+	// PushFormat defaults to JSON, PROTOBUF push body is snappy compressed
+	PushFormat PushFormat
+	Gzip       bool
+	// Retry does not repeat 4xx responses except 408 and 429
+	Retry      retry.Policy
+	DeadLetter retry.DeadLetter
+
+	// TenantID is sent as X-Scope-OrgID header for multi-tenant loki
+	TenantID          string
+	BasicAuthUser     string
+	BasicAuthPassword string
+	// BearerToken is used instead of basic auth when set
+	BearerToken string
+	Headers     map[string]string
+	TLS         tls_config.Config
+	// ProxyUrl overrides HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment settings
+	ProxyUrl string
 }
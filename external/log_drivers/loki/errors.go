@@ -0,0 +1,5 @@
+package loki
+
+import "golibs/errors"
+
+var ConfigError = errors.NewWrapper("invalid loki config", errors.ValidationErrorType)
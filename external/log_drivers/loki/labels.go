@@ -0,0 +1,122 @@
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golibs/logging"
+)
+
+const containerNameLabel = "container_name"
+
+// DefaultLabelFields are low cardinality fields used as stream labels when Config.LabelFields is empty
+var DefaultLabelFields = []string{logging.LogLvlFieldKey, logging.MethodFieldKey, logging.StatusCodeFieldKey}
+
+type labelPolicy struct {
+	static   map[string]string
+	fields   map[string]string
+	metadata map[string]string
+}
+
+type labelPair struct {
+	name  string
+	value string
+}
+
+func newLabelPolicy(conf Config) labelPolicy {
+	policy := labelPolicy{
+		static:   map[string]string{},
+		fields:   map[string]string{},
+		metadata: map[string]string{},
+	}
+
+	for name, value := range conf.StaticLabels {
+		policy.static[labelName(name)] = value
+	}
+	if conf.ContainerName != "" {
+		policy.static[containerNameLabel] = conf.ContainerName
+	}
+
+	labelFields := conf.LabelFields
+	if len(labelFields) == 0 {
+		labelFields = DefaultLabelFields
+	}
+	for _, name := range labelFields {
+		policy.fields[name] = labelName(name)
+	}
+
+	for _, name := range conf.StructuredMetadataFields {
+		policy.metadata[name] = labelName(name)
+	}
+
+	return policy
+}
+
+// split returns stream labels, fields rendered into log line and structured metadata of the entry
+func (p labelPolicy) split(fields []logging.LogField) (labels map[string]string, lineFields []logging.LogField, metadata []labelPair) {
+	labels = make(map[string]string, len(p.static)+len(p.fields))
+	for name, value := range p.static {
+		labels[name] = value
+	}
+
+	lineFields = fields
+	if len(p.metadata) > 0 {
+		lineFields = make([]logging.LogField, 0, len(fields))
+	}
+
+	for _, field := range fields {
+		if name, ok := p.fields[field.Name]; ok {
+			if value := labelValue(field.Value); value != "" {
+				if field.Name == logging.LogLvlFieldKey {
+					value = strings.ToLower(value)
+				}
+				labels[name] = value
+			}
+		}
+
+		if name, ok := p.metadata[field.Name]; ok {
+			metadata = append(metadata, labelPair{name: name, value: labelValue(field.Value)})
+			continue
+		}
+		if len(p.metadata) > 0 {
+			lineFields = append(lineFields, field)
+		}
+	}
+
+	return
+}
+
+func labelName(name string) string {
+	result := []rune(name)
+	for i, r := range result {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		result[i] = '_'
+	}
+
+	return string(result)
+}
+
+func labelValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
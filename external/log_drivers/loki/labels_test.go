@@ -0,0 +1,112 @@
+package loki
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golibs/logging"
+)
+
+func TestLabelPolicySplit(t *testing.T) {
+	fields := []logging.LogField{
+		{Name: logging.LogLvlFieldKey, Value: "ERROR"},
+		{Name: logging.MessageFieldKey, Value: "request failed"},
+		{Name: logging.MethodFieldKey, Value: "GET"},
+		{Name: logging.StatusCodeFieldKey, Value: 500},
+		{Name: logging.RequestIdFieldKey, Value: "3f2a9c"},
+		{Name: logging.ErrorFieldKey, Value: errors.New("timeout")},
+		{Name: "user.id", Value: 42},
+	}
+
+	for _, test := range []struct {
+		name       string
+		conf       Config
+		labels     map[string]string
+		lineFields []string
+		metadata   []labelPair
+	}{
+		{
+			name:       "default label fields",
+			conf:       Config{},
+			labels:     map[string]string{"level": "error", "method": "GET", "status_code": "500"},
+			lineFields: []string{"level", "message", "method", "status_code", "request_id", "error", "user.id"},
+		},
+		{
+			name: "static labels and container name",
+			conf: Config{ContainerName: "api", StaticLabels: map[string]string{"env-name": "prod"}},
+			labels: map[string]string{
+				"container_name": "api", "env_name": "prod", "level": "error", "method": "GET", "status_code": "500",
+			},
+			lineFields: []string{"level", "message", "method", "status_code", "request_id", "error", "user.id"},
+		},
+		{
+			name:       "configured label fields replace defaults",
+			conf:       Config{LabelFields: []string{"user.id"}},
+			labels:     map[string]string{"user_id": "42"},
+			lineFields: []string{"level", "message", "method", "status_code", "request_id", "error", "user.id"},
+		},
+		{
+			name:       "structured metadata is removed from line",
+			conf:       Config{StructuredMetadataFields: []string{logging.RequestIdFieldKey, "user.id"}},
+			labels:     map[string]string{"level": "error", "method": "GET", "status_code": "500"},
+			lineFields: []string{"level", "message", "method", "status_code", "error"},
+			metadata:   []labelPair{{name: "request_id", value: "3f2a9c"}, {name: "user_id", value: "42"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			labels, lineFields, metadata := newLabelPolicy(test.conf).split(fields)
+
+			if !reflect.DeepEqual(labels, test.labels) {
+				t.Errorf("labels %v, expected %v", labels, test.labels)
+			}
+			var names []string
+			for _, field := range lineFields {
+				names = append(names, field.Name)
+			}
+			if !reflect.DeepEqual(names, test.lineFields) {
+				t.Errorf("line fields %v, expected %v", names, test.lineFields)
+			}
+			if !reflect.DeepEqual(metadata, test.metadata) {
+				t.Errorf("metadata %v, expected %v", metadata, test.metadata)
+			}
+		})
+	}
+}
+
+func TestDefaultLabelsExcludeHighCardinalityFields(t *testing.T) {
+	policy := newLabelPolicy(Config{})
+	for _, name := range []string{
+		logging.MessageFieldKey, logging.TimeFieldKey, logging.RequestIdFieldKey, logging.ErrorFieldKey,
+		logging.LatencyFieldKey, logging.RemoteAddressFieldKey, logging.CallerFieldKey, logging.StackFieldKey,
+	} {
+		labels, _, _ := policy.split([]logging.LogField{{Name: name, Value: "unique value"}})
+		if len(labels) != 0 {
+			t.Errorf("high cardinality field %s is used as label %v", name, labels)
+		}
+	}
+}
+
+func TestLabelPolicySkipsEmptyValues(t *testing.T) {
+	labels, _, _ := newLabelPolicy(Config{}).split([]logging.LogField{
+		{Name: logging.LogLvlFieldKey, Value: nil},
+		{Name: logging.MethodFieldKey, Value: ""},
+	})
+	if len(labels) != 0 {
+		t.Errorf("empty fields produced labels %v", labels)
+	}
+}
+
+func TestLabelName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"level":       "level",
+		"http.method": "http_method",
+		"env-name":    "env_name",
+		"1st":         "_st",
+		"code2":       "code2",
+	} {
+		if got := labelName(name); got != expected {
+			t.Errorf("label name of %q is %q, expected %q", name, got, expected)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	JsonPushFormat     PushFormat = "JSON"
+	ProtobufPushFormat PushFormat = "PROTOBUF"
+)
+
+type PushFormat string
+
+type pushStream struct {
+	labels  map[string]string
+	key     string
+	entries []pushEntry
+}
+
+type pushEntry struct {
+	ts       time.Time
+	line     string
+	metadata []labelPair
+}
+
+type dto struct {
+	Streams []stream `json:"streams"`
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]interface{}   `json:"values"`
+}
+
+func encodeJsonPush(streams []*pushStream) ([]byte, error) {
+	data := dto{Streams: make([]stream, 0, len(streams))}
+	for _, s := range streams {
+		values := make([][]interface{}, 0, len(s.entries))
+		for _, entry := range s.entries {
+			value := []interface{}{strconv.FormatInt(entry.ts.UnixNano(), 10), entry.line}
+			if len(entry.metadata) > 0 {
+				metadata := make(map[string]string, len(entry.metadata))
+				for _, pair := range entry.metadata {
+					metadata[pair.name] = pair.value
+				}
+				value = append(value, metadata)
+			}
+			values = append(values, value)
+		}
+		data.Streams = append(data.Streams, stream{Stream: s.labels, Values: values})
+	}
+
+	return json.Marshal(data)
+}
+
+// encodeProtobufPush encodes logproto.PushRequest:
+// PushRequest{streams = 1}, StreamAdapter{labels = 1, entries = 2},
+// EntryAdapter{timestamp = 1, line = 2, structuredMetadata = 3}, LabelPairAdapter{name = 1, value = 2}
+func encodeProtobufPush(streams []*pushStream) []byte {
+	var request []byte
+	for _, s := range streams {
+		var streamData []byte
+		streamData = appendProtoBytes(streamData, 1, []byte(s.key))
+		for _, entry := range s.entries {
+			var timestamp []byte
+			timestamp = appendProtoVarint(timestamp, 1, uint64(entry.ts.Unix()))
+			timestamp = appendProtoVarint(timestamp, 2, uint64(entry.ts.Nanosecond()))
+
+			var entryData []byte
+			entryData = appendProtoBytes(entryData, 1, timestamp)
+			entryData = appendProtoBytes(entryData, 2, []byte(entry.line))
+			for _, pair := range entry.metadata {
+				var pairData []byte
+				pairData = appendProtoBytes(pairData, 1, []byte(pair.name))
+				pairData = appendProtoBytes(pairData, 2, []byte(pair.value))
+				entryData = appendProtoBytes(entryData, 3, pairData)
+			}
+
+			streamData = appendProtoBytes(streamData, 2, entryData)
+		}
+		request = appendProtoBytes(request, 1, streamData)
+	}
+
+	return request
+}
+
+func appendProtoVarint(buf []byte, field int, value uint64) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3)
+	return appendUvarint(buf, value)
+}
+
+func appendProtoBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3|2)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendUvarint(buf []byte, value uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], value)
+	return append(buf, tmp[:n]...)
+}
+
+// labelsString renders labels in prometheus format with sorted names, it is also the stream grouping key
+func labelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func gzipEncode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
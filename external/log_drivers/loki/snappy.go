@@ -0,0 +1,90 @@
+package loki
+
+import "encoding/binary"
+
+const (
+	snappyBlockSize   = 1 << 16
+	snappyMinMatch    = 4
+	snappyTableBits   = 14
+	snappyTagLiteral  = 0x00
+	snappyTagCopy2    = 0x02
+	snappyMaxCopySize = 64
+)
+
+// snappyEncode compresses data in snappy block format expected by loki protobuf push endpoint
+func snappyEncode(src []byte) []byte {
+	dst := appendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyBlockSize {
+			block = block[:snappyBlockSize]
+		}
+		src = src[len(block):]
+		dst = snappyEncodeBlock(dst, block)
+	}
+
+	return dst
+}
+
+func snappyEncodeBlock(dst, src []byte) []byte {
+	var table [1 << snappyTableBits]int
+	literalStart := 0
+
+	for i := 0; i+snappyMinMatch <= len(src); {
+		value := binary.LittleEndian.Uint32(src[i:])
+		hash := (value * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := table[hash] - 1
+		table[hash] = i + 1
+
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != value {
+			i++
+			continue
+		}
+
+		dst = snappyEmitLiteral(dst, src[literalStart:i])
+		length := snappyMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = snappyEmitCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+
+	return snappyEmitLiteral(dst, src[literalStart:])
+}
+
+func snappyEmitLiteral(dst, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+
+	n := len(literal) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+
+	return append(dst, literal...)
+}
+
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > snappyMaxCopySize {
+			n = snappyMaxCopySize
+		}
+		dst = append(dst, byte(n-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+
+	return dst
+}
@@ -0,0 +1,59 @@
+package loki
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"golibs/external/log_drivers/tls_config"
+)
+
+const (
+	tenantHeader      = "X-Scope-OrgID"
+	defaultTimeOutSec = 10
+)
+
+func newHttpClient(conf Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if conf.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(conf.ProxyUrl)
+		if err != nil {
+			return nil, ConfigError.Wrap(err)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConf, err := tls_config.New(conf.TLS, "")
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConf
+
+	timeOut := conf.TimeOutSec
+	if timeOut <= 0 {
+		timeOut = defaultTimeOutSec
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Second * time.Duration(timeOut),
+	}, nil
+}
+
+func (l *loki) setHeaders(request *http.Request) {
+	for name, value := range l.headers {
+		request.Header.Set(name, value)
+	}
+
+	if l.tenantID != "" {
+		request.Header.Set(tenantHeader, l.tenantID)
+	}
+
+	switch {
+	case l.bearerToken != "":
+		request.Header.Set("Authorization", "Bearer "+l.bearerToken)
+	case l.basicAuthUser != "":
+		request.SetBasicAuth(l.basicAuthUser, l.basicAuthPassword)
+	}
+}
@@ -0,0 +1,227 @@
+package nats
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/logging"
+)
+
+const (
+	defaultQueueCapacity = 10000
+	defaultBatchEntries  = 1000
+	defaultBatchWait     = 100 * time.Millisecond
+	defaultAckTimeout    = 5 * time.Second
+)
+
+func NewNats(conf Config) (*natsWriter, error) {
+	if _, _, err := connectTarget(conf); err != nil {
+		return nil, err
+	}
+
+	switch conf.Acks {
+	case "":
+		conf.Acks = FlushAcks
+	case NoAcks, FlushAcks, JetStreamAcks:
+	default:
+		return nil, ConfigError.NewF("unknown nats ack mode %q, expected one of NONE, FLUSH, JETSTREAM", string(conf.Acks))
+	}
+
+	if conf.Subject == "" {
+		conf.Subject = DefaultSubject
+	}
+	if conf.AckTimeout <= 0 {
+		conf.AckTimeout = defaultAckTimeout
+	}
+	if conf.Formatter == nil {
+		conf.Formatter = logging.NewJsonFormatter()
+	}
+
+	result := &natsWriter{
+		conf:  conf,
+		retry: conf.Retry.WithDefaults(),
+	}
+
+	queue, err := logging.NewBatchQueue(
+		conf.Queue.WithDefaults(defaultQueueCapacity, logging.OverflowBlock),
+		conf.Batch.WithDefaults(defaultBatchEntries, defaultBatchWait),
+		result.sendBatch,
+	)
+	if err != nil {
+		return nil, err
+	}
+	result.queue = queue
+
+	return result, nil
+}
+
+type natsWriter struct {
+	conf   Config
+	queue  *logging.Queue
+	retry  retry.Policy
+	health retry.Health
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+func (n *natsWriter) Print(_ string, fields []logging.LogField) {
+	n.queue.Push(logging.Entry{Fields: fields})
+}
+
+func (n *natsWriter) Flush(ctx context.Context) error {
+	return n.queue.Flush(ctx)
+}
+
+func (n *natsWriter) Close() error {
+	err := n.queue.Close()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn != nil {
+		if closeErr := n.conn.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		n.conn = nil
+	}
+
+	return err
+}
+
+func (n *natsWriter) Stats() logging.QueueStats {
+	return n.queue.Stats()
+}
+
+// Healthy reports whether the last publish was acknowledged according to ack mode
+func (n *natsWriter) Healthy() bool {
+	return n.health.Healthy()
+}
+
+// sendBatch publishes entries, entries larger than server max payload are passed to dead letter immediately
+func (n *natsWriter) sendBatch(ctx context.Context, entries []logging.Entry) {
+	conn, err := n.connection()
+	if err != nil {
+		n.sendWithRetry(ctx, entries, n.messages(entries))
+		return
+	}
+
+	var accepted []logging.Entry
+	var messages []message
+	for i, msg := range n.messages(entries) {
+		if len(msg.payload) > conn.maxPayload {
+			retry.Drop(n.conf.DeadLetter, entries[i:i+1], retry.Permanent(ConnectionError.NewF(
+				"entry of %d bytes exceeds nats max payload %d", len(msg.payload), conn.maxPayload)))
+			continue
+		}
+		accepted = append(accepted, entries[i])
+		messages = append(messages, msg)
+	}
+
+	if len(messages) > 0 {
+		n.sendWithRetry(ctx, accepted, messages)
+	}
+}
+
+// sendWithRetry resends messages which are not acknowledged, connection is reopened after errors
+func (n *natsWriter) sendWithRetry(ctx context.Context, entries []logging.Entry, messages []message) {
+	err := n.retry.Do(ctx, func() (err error) {
+		defer func() { n.health.Record(err) }()
+
+		conn, err := n.connection()
+		if err != nil {
+			return err
+		}
+
+		failed, err := conn.publish(ctx, messages, n.conf.Acks, n.conf.AckTimeout)
+		if err != nil {
+			n.disconnect(conn)
+			return err
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+
+		retryEntries := make([]logging.Entry, len(failed))
+		retryMessages := make([]message, len(failed))
+		for i, index := range failed {
+			retryEntries[i], retryMessages[i] = entries[index], messages[index]
+		}
+		entries, messages = retryEntries, retryMessages
+
+		return AckError.NewF("%d entries are not acknowledged", len(failed))
+	})
+	if err != nil {
+		retry.Drop(n.conf.DeadLetter, entries, err)
+	}
+}
+
+func (n *natsWriter) messages(entries []logging.Entry) []message {
+	result := make([]message, len(entries))
+	for i, entry := range entries {
+		result[i] = message{
+			subject: n.subject(entry.Fields),
+			payload: []byte(n.conf.Formatter.Format(entry.Fields)),
+		}
+	}
+
+	return result
+}
+
+func (n *natsWriter) subject(fields []logging.LogField) string {
+	if !n.conf.KeyByRequestId {
+		return n.conf.Subject
+	}
+
+	token := NoRequestIdToken
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Name == logging.RequestIdFieldKey {
+			if value, ok := fields[i].Value.(string); ok && value != "" {
+				token = subjectToken(value)
+			}
+			break
+		}
+	}
+
+	return n.conf.Subject + "." + token
+}
+
+// subjectToken replaces separators and wildcards which are not allowed inside single subject token
+func subjectToken(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '.' || r == '*' || r == '>' {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func (n *natsWriter) connection() (*conn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn != nil {
+		return n.conn, nil
+	}
+
+	conn, err := dial(n.conf)
+	if err != nil {
+		return nil, err
+	}
+	n.conn = conn
+
+	return conn, nil
+}
+
+func (n *natsWriter) disconnect(broken *conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == broken {
+		_ = n.conn.close()
+		n.conn = nil
+	}
+}
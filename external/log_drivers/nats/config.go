@@ -0,0 +1,49 @@
+package nats
+
+import (
+	"time"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/logging"
+)
+
+type AckMode string
+
+const (
+	// NoAcks writes entries to connection without waiting for server
+	NoAcks AckMode = "NONE"
+	// FlushAcks waits until server has processed every entry of the batch
+	FlushAcks AckMode = "FLUSH"
+	// JetStreamAcks waits for jetstream acknowledgement of every entry, entries which are not acknowledged are resent
+	JetStreamAcks AckMode = "JETSTREAM"
+)
+
+const (
+	DefaultSubject = "logs"
+	// NoRequestIdToken is used as subject token of entries without request id
+	NoRequestIdToken = "none"
+)
+
+// Config is nats printer configuration, zero values are replaced with defaults
+type Config struct {
+	// Url is nats://host:port, user and password from url are used for authentication
+	Url        string
+	TimeOutSec int
+	Name       string
+	User       string
+	Password   string
+	Token      string
+	Subject    string
+	// KeyByRequestId appends request id token to subject, e.g. logs.<request_id>, so consumers can
+	// subscribe to single request or keep request entries together with logs.* subscription
+	KeyByRequestId bool
+	Acks           AckMode
+	// AckTimeout bounds waiting for acknowledgements of single batch, defaults to 5 seconds
+	AckTimeout time.Duration
+	Formatter  logging.Formatter
+	// Queue blocks the caller when full by default, so slow bus applies backpressure to logging
+	Queue      logging.QueueConfig
+	Batch      logging.BatchConfig
+	Retry      retry.Policy
+	DeadLetter retry.DeadLetter
+}
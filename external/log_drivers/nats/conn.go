@@ -0,0 +1,412 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeOutSec = 10
+	defaultMaxPayload = 1 << 20
+	ackSid            = "1"
+)
+
+type message struct {
+	subject string
+	payload []byte
+}
+
+type serverInfo struct {
+	MaxPayload int `json:"max_payload"`
+}
+
+type connectOptions struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name,omitempty"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+type pubAck struct {
+	Error *struct {
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// conn implements publishing part of nats text protocol, it is broken after the first read or write error
+type conn struct {
+	netConn    net.Conn
+	reader     *bufio.Reader
+	maxPayload int
+	inbox      string
+	// writeTimeOut bounds every write under mu, so stalled server breaks the connection instead of holding mu
+	writeTimeOut time.Duration
+
+	mu     sync.Mutex
+	writer *bufio.Writer
+	pongs  []chan struct{}
+	acks   map[string]chan error
+	nextID uint64
+	err    error
+	done   chan struct{}
+}
+
+func dial(conf Config) (*conn, error) {
+	address, options, err := connectTarget(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	timeOut := time.Second * time.Duration(conf.TimeOutSec)
+	if conf.TimeOutSec <= 0 {
+		timeOut = time.Second * defaultTimeOutSec
+	}
+
+	netConn, err := net.DialTimeout("tcp", address, timeOut)
+	if err != nil {
+		return nil, ConnectionError.Wrap(err)
+	}
+
+	c := &conn{
+		netConn:      netConn,
+		reader:       bufio.NewReader(netConn),
+		writer:       bufio.NewWriter(netConn),
+		maxPayload:   defaultMaxPayload,
+		writeTimeOut: timeOut,
+		acks:         map[string]chan error{},
+		done:         make(chan struct{}),
+	}
+
+	if err = c.handshake(options, timeOut, conf.Acks == JetStreamAcks); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+
+	return c, nil
+}
+
+func connectTarget(conf Config) (address string, options connectOptions, err error) {
+	target, err := url.Parse(conf.Url)
+	if err != nil {
+		return "", options, ConfigError.Wrap(err)
+	}
+	if target.Host == "" {
+		return "", options, ConfigError.NewF("nats url %q has no host", conf.Url)
+	}
+
+	address = target.Host
+	if target.Port() == "" {
+		address = net.JoinHostPort(target.Hostname(), "4222")
+	}
+
+	options = connectOptions{
+		Name:     conf.Name,
+		Lang:     "go",
+		Version:  "golibs",
+		Protocol: 1,
+		User:     conf.User,
+		Pass:     conf.Password,
+		Token:    conf.Token,
+	}
+	if target.User != nil && options.User == "" {
+		options.User = target.User.Username()
+		options.Pass, _ = target.User.Password()
+	}
+
+	return address, options, nil
+}
+
+// handshake reads server INFO, sends CONNECT and waits for PONG which confirms accepted credentials
+func (c *conn) handshake(options connectOptions, timeOut time.Duration, jetStream bool) error {
+	_ = c.netConn.SetDeadline(time.Now().Add(timeOut))
+	defer c.netConn.SetDeadline(time.Time{})
+
+	line, err := c.readLine()
+	if err != nil {
+		return ConnectionError.Wrap(err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return ConnectionError.NewF("unexpected nats greeting %q", line)
+	}
+
+	var info serverInfo
+	if err = json.Unmarshal([]byte(line[len("INFO "):]), &info); err != nil {
+		return ConnectionError.Wrap(err)
+	}
+	if info.MaxPayload > 0 {
+		c.maxPayload = info.MaxPayload
+	}
+
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return ConnectionError.Wrap(err)
+	}
+	c.writer.WriteString("CONNECT " + string(connect) + "\r\n")
+
+	if jetStream {
+		id := make([]byte, 12)
+		if _, err = rand.Read(id); err != nil {
+			return ConnectionError.Wrap(err)
+		}
+		c.inbox = "_INBOX." + hex.EncodeToString(id)
+		c.writer.WriteString("SUB " + c.inbox + ".* " + ackSid + "\r\n")
+	}
+
+	c.writer.WriteString("PING\r\n")
+	if err = c.writer.Flush(); err != nil {
+		return ConnectionError.Wrap(err)
+	}
+
+	for {
+		line, err = c.readLine()
+		if err != nil {
+			return ConnectionError.Wrap(err)
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return ConnectionError.New(strings.TrimSpace(line[len("-ERR"):]))
+		}
+	}
+}
+
+// publish writes batch and waits for acknowledgements according to ack mode,
+// it returns indexes of messages not acknowledged by jetstream within timeOut and error when connection is broken
+func (c *conn) publish(ctx context.Context, messages []message, mode AckMode, timeOut time.Duration) (failed []int, err error) {
+	var pong chan struct{}
+	acks := make([]chan error, len(messages))
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+
+	// buffered writer writes to connection when the buffer is full, so deadline covers the whole batch
+	c.setWriteDeadline()
+	for i, msg := range messages {
+		c.writer.WriteString("PUB " + msg.subject)
+		if mode == JetStreamAcks {
+			c.nextID++
+			id := strconv.FormatUint(c.nextID, 10)
+			acks[i] = make(chan error, 1)
+			c.acks[id] = acks[i]
+			c.writer.WriteString(" " + c.inbox + "." + id)
+		}
+		c.writer.WriteString(" " + strconv.Itoa(len(msg.payload)) + "\r\n")
+		c.writer.Write(msg.payload)
+		c.writer.WriteString("\r\n")
+	}
+
+	if mode == FlushAcks {
+		pong = make(chan struct{})
+		c.pongs = append(c.pongs, pong)
+		c.writer.WriteString("PING\r\n")
+	}
+
+	if err = c.writer.Flush(); err != nil {
+		c.failLocked(err)
+		err = c.err
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// done context stays done, so every ack missing after timeout is reported without waiting again
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+
+	switch mode {
+	case FlushAcks:
+		select {
+		case <-pong:
+		case <-c.done:
+			return nil, c.error()
+		case <-ctx.Done():
+			return nil, AckError.NewF("server did not respond in %s", timeOut)
+		}
+	case JetStreamAcks:
+		for i, ack := range acks {
+			select {
+			case ackErr := <-ack:
+				if ackErr != nil {
+					failed = append(failed, i)
+				}
+			case <-c.done:
+				return nil, c.error()
+			case <-ctx.Done():
+				// ack received before timeout may be still unread when select picks done context
+				select {
+				case ackErr := <-ack:
+					if ackErr == nil {
+						continue
+					}
+				default:
+				}
+				failed = append(failed, i)
+			}
+		}
+		c.removeAcks(acks)
+	}
+
+	return failed, nil
+}
+
+func (c *conn) readLoop() {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		switch {
+		case line == "PING":
+			c.mu.Lock()
+			c.setWriteDeadline()
+			c.writer.WriteString("PONG\r\n")
+			if err = c.writer.Flush(); err != nil {
+				c.failLocked(err)
+			}
+			c.mu.Unlock()
+		case line == "PONG":
+			c.mu.Lock()
+			if len(c.pongs) > 0 {
+				close(c.pongs[0])
+				c.pongs = c.pongs[1:]
+			}
+			c.mu.Unlock()
+		case strings.HasPrefix(line, "MSG "):
+			if err = c.readAck(strings.Fields(line)); err != nil {
+				c.fail(err)
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			c.fail(ConnectionError.New(strings.TrimSpace(line[len("-ERR"):])))
+			return
+		}
+	}
+}
+
+// readAck reads jetstream acknowledgement sent as MSG <subject> <sid> [reply] <size>
+func (c *conn) readAck(args []string) error {
+	if len(args) < 4 {
+		return ConnectionError.NewF("malformed nats message %q", strings.Join(args, " "))
+	}
+
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return ConnectionError.Wrap(err)
+	}
+
+	payload := make([]byte, size+2)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	var ack pubAck
+	ackErr := json.Unmarshal(payload[:size], &ack)
+	if ackErr == nil && ack.Error != nil {
+		ackErr = AckError.New(ack.Error.Description)
+	}
+
+	id := args[1][strings.LastIndex(args[1], ".")+1:]
+	c.mu.Lock()
+	if ch, ok := c.acks[id]; ok {
+		ch <- ackErr
+		delete(c.acks, id)
+	}
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *conn) removeAcks(acks []chan error) {
+	pending := make(map[chan error]bool, len(acks))
+	for _, ack := range acks {
+		pending[ack] = true
+	}
+
+	c.mu.Lock()
+	for id, ack := range c.acks {
+		if pending[ack] {
+			delete(c.acks, id)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *conn) fail(err error) {
+	c.mu.Lock()
+	c.failLocked(err)
+	c.mu.Unlock()
+}
+
+func (c *conn) failLocked(err error) {
+	if c.err != nil {
+		return
+	}
+
+	c.err = ConnectionError.Wrap(err)
+	close(c.done)
+	_ = c.netConn.Close()
+}
+
+func (c *conn) setWriteDeadline() {
+	_ = c.netConn.SetWriteDeadline(time.Now().Add(c.writeTimeOut))
+}
+
+func (c *conn) error() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *conn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil
+	}
+
+	c.setWriteDeadline()
+	err := c.writer.Flush()
+	c.failLocked(io.EOF)
+	if err != nil {
+		return ConnectionError.Wrap(err)
+	}
+
+	return nil
+}
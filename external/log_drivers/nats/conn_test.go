@@ -0,0 +1,113 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golibs/external/log_drivers/nats/natstest"
+)
+
+func publishJetStream(t *testing.T, conf natstest.Config, payloads ...string) []int {
+	t.Helper()
+
+	conf.JetStream = true
+	server, err := natstest.NewServer(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	c, err := dial(Config{Url: server.Url(), Acks: JetStreamAcks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	messages := make([]message, len(payloads))
+	for i, payload := range payloads {
+		messages[i] = message{subject: DefaultSubject, payload: []byte(payload)}
+	}
+
+	done := make(chan []int, 1)
+	go func() {
+		failed, err := c.publish(context.Background(), messages, JetStreamAcks, 100*time.Millisecond)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- failed
+	}()
+
+	select {
+	case failed := <-done:
+		return failed
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish does not return")
+		return nil
+	}
+}
+
+func TestPublishReportsRejectedMessages(t *testing.T) {
+	failed := publishJetStream(t, natstest.Config{
+		Reject: func(msg natstest.Message) string {
+			if strings.HasPrefix(string(msg.Data), "bad") {
+				return "stream is full"
+			}
+			return ""
+		},
+	}, "bad 1", "good", "bad 2")
+
+	if expected := []int{0, 2}; !reflect.DeepEqual(failed, expected) {
+		t.Errorf("failed messages are %v, expected %v", failed, expected)
+	}
+}
+
+func TestPublishReportsEveryMissingAck(t *testing.T) {
+	failed := publishJetStream(t, natstest.Config{
+		SkipAck: func(msg natstest.Message) bool {
+			return strings.HasPrefix(string(msg.Data), "lost")
+		},
+	}, "lost 1", "lost 2", "good", "lost 3")
+
+	if expected := []int{0, 1, 3}; !reflect.DeepEqual(failed, expected) {
+		t.Errorf("failed messages are %v, expected %v", failed, expected)
+	}
+}
+
+func TestPublishWriteDeadline(t *testing.T) {
+	// server side of the pipe never reads, so every write blocks
+	client, server := net.Pipe()
+	defer server.Close()
+
+	c := &conn{
+		netConn:      client,
+		reader:       bufio.NewReader(client),
+		writer:       bufio.NewWriter(client),
+		writeTimeOut: 50 * time.Millisecond,
+		acks:         map[string]chan error{},
+		done:         make(chan struct{}),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.publish(context.Background(), []message{{subject: DefaultSubject, payload: []byte("entry")}}, FlushAcks, time.Second)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "timeout") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish to stalled server does not time out")
+	}
+
+	if c.error() == nil {
+		t.Error("connection is not broken after write timeout")
+	}
+}
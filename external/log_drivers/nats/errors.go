@@ -0,0 +1,10 @@
+package nats
+
+import "golibs/errors"
+
+var (
+	ConfigError     = errors.NewWrapper("invalid nats config", errors.ValidationErrorType)
+	ConnectionError = errors.NewWrapper("nats connection error")
+	// AckError is returned when jetstream does not acknowledge published entries
+	AckError = errors.NewWrapper("nats entries are not acknowledged")
+)
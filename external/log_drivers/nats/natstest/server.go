@@ -0,0 +1,236 @@
+// Package natstest provides in-process fake nats broker for testing log shipping
+package natstest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultMaxPayload = 1 << 20
+
+type Message struct {
+	Subject string
+	Reply   string
+	Data    []byte
+}
+
+type Config struct {
+	// JetStream acknowledges every publish with reply subject
+	JetStream bool
+	// Reject returns error description of jetstream negative acknowledgement, message is not recorded when it is not empty
+	Reject func(msg Message) string
+	// SkipAck records message without sending jetstream acknowledgement when it returns true
+	SkipAck func(msg Message) bool
+	// MaxPayload defaults to 1MB
+	MaxPayload int
+}
+
+// Server accepts nats clients on loopback address and records published messages,
+// it supports PUB, SUB, PING and replies to publishes with jetstream acknowledgements
+type Server struct {
+	conf     Config
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	conns    map[net.Conn]bool
+	sequence uint64
+	wg       sync.WaitGroup
+}
+
+func NewServer(conf Config) (*Server, error) {
+	if conf.MaxPayload <= 0 {
+		conf.MaxPayload = DefaultMaxPayload
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		conf:     conf,
+		listener: listener,
+		conns:    map[net.Conn]bool{},
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+func (s *Server) Url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+// Messages returns copy of recorded messages in publish order
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// DropConnections closes every client connection to simulate broker restart
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	subscriptions := map[string]string{}
+
+	fmt.Fprintf(writer, `INFO {"server_id":"natstest","version":"2.10.0","proto":1,"max_payload":%d}`+"\r\n", s.conf.MaxPayload)
+	if writer.Flush() != nil {
+		return
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			writer.WriteString("PONG\r\n")
+		case "SUB":
+			if len(args) >= 3 {
+				subscriptions[args[len(args)-1]] = args[1]
+			}
+		case "PUB":
+			msg, err := s.readPublish(reader, args)
+			if err != nil {
+				fmt.Fprintf(writer, "-ERR '%s'\r\n", err.Error())
+				writer.Flush()
+				return
+			}
+			s.publish(writer, msg, subscriptions)
+		}
+
+		if reader.Buffered() == 0 && writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) readPublish(reader *bufio.Reader, args []string) (msg Message, err error) {
+	if len(args) != 3 && len(args) != 4 {
+		return msg, fmt.Errorf("Unknown Protocol Operation")
+	}
+
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return msg, fmt.Errorf("Invalid Message Size")
+	}
+	if size > s.conf.MaxPayload {
+		return msg, fmt.Errorf("Maximum Payload Violation")
+	}
+
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return msg, err
+	}
+
+	msg = Message{Subject: args[1], Data: data[:size]}
+	if len(args) == 4 {
+		msg.Reply = args[2]
+	}
+
+	return msg, nil
+}
+
+func (s *Server) publish(writer *bufio.Writer, msg Message, subscriptions map[string]string) {
+	var rejection string
+	if s.conf.Reject != nil {
+		rejection = s.conf.Reject(msg)
+	}
+
+	s.mu.Lock()
+	if rejection == "" {
+		s.messages = append(s.messages, msg)
+		s.sequence++
+	}
+	sequence := s.sequence
+	s.mu.Unlock()
+
+	if !s.conf.JetStream || msg.Reply == "" || (s.conf.SkipAck != nil && s.conf.SkipAck(msg)) {
+		return
+	}
+
+	ack := fmt.Sprintf(`{"stream":"LOGS","seq":%d}`, sequence)
+	if rejection != "" {
+		ack = fmt.Sprintf(`{"error":{"code":503,"description":%q}}`, rejection)
+	}
+
+	for sid, subject := range subscriptions {
+		if matches(subject, msg.Reply) {
+			fmt.Fprintf(writer, "MSG %s %s %d\r\n%s\r\n", msg.Reply, sid, len(ack), ack)
+		}
+	}
+}
+
+func matches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+
+	return len(patternTokens) == len(subjectTokens)
+}
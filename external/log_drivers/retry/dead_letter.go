@@ -0,0 +1,92 @@
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golibs/errors"
+	"golibs/logging"
+)
+
+// DeadLetter receives entries which could not be delivered by log driver, drivers print them to stdout when it is nil
+type DeadLetter interface {
+	Put(entries []logging.Entry, err error)
+}
+
+type DeadLetterFunc func(entries []logging.Entry, err error)
+
+func (f DeadLetterFunc) Put(entries []logging.Entry, err error) {
+	f(entries, err)
+}
+
+// NewFileDeadLetter appends undelivered entries to path as json lines with delivery error
+func NewFileDeadLetter(path string) (*fileDeadLetter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileDeadLetter{file: file}, nil
+}
+
+type fileDeadLetter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+type deadLetterRecord struct {
+	Time   string                 `json:"time"`
+	Error  string                 `json:"error"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+func (f *fileDeadLetter) Put(entries []logging.Entry, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, entry := range entries {
+		fields := make(map[string]interface{}, len(entry.Fields))
+		for _, field := range entry.Fields {
+			fields[field.Name] = field.Value
+		}
+
+		data, marshalErr := json.Marshal(deadLetterRecord{
+			Time:   time.Now().UTC().Format(time.RFC3339Nano),
+			Error:  errors.GetInsideErrMsg(err),
+			Fields: fields,
+		})
+		if marshalErr != nil {
+			PrintDropped(1, marshalErr)
+			continue
+		}
+
+		if _, writeErr := f.file.Write(append(data, '\n')); writeErr != nil {
+			PrintDropped(1, writeErr)
+		}
+	}
+}
+
+func (f *fileDeadLetter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// Drop passes entries to deadLetter or prints the drop when it is nil
+func Drop(deadLetter DeadLetter, entries []logging.Entry, err error) {
+	if deadLetter != nil {
+		deadLetter.Put(entries, err)
+		return
+	}
+
+	PrintDropped(len(entries), err)
+}
+
+func PrintDropped(count int, err error) {
+	fmt.Println(fmt.Sprintf(`{"error":%q,"message":"%d log entries are dropped by log driver","time":"%s"}`,
+		errors.GetInsideErrMsg(err), count, time.Now().UTC().Format(time.RFC3339)))
+}
@@ -0,0 +1,24 @@
+package retry
+
+import "sync/atomic"
+
+// Health keeps outcome of the last delivery attempt for logging.Healthy, zero value is healthy
+type Health struct {
+	failed int32
+}
+
+// Record stores attempt outcome and returns err, permanent errors mean the server is reachable
+// but rejected entries, so they do not make driver unhealthy
+func (h *Health) Record(err error) error {
+	var failed int32
+	if err != nil && !IsPermanent(err) {
+		failed = 1
+	}
+	atomic.StoreInt32(&h.failed, failed)
+
+	return err
+}
+
+func (h *Health) Healthy() bool {
+	return atomic.LoadInt32(&h.failed) == 0
+}
@@ -0,0 +1,130 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"golibs/errors"
+)
+
+const (
+	defaultInitialInterval = time.Second
+	defaultMaxInterval     = time.Minute
+	defaultMultiplier      = 2
+	defaultJitter          = 0.2
+	defaultMaxAttempts     = 10
+)
+
+var (
+	// PermanentError marks delivery errors which are not retried, e.g. 4xx responses or marshaling errors
+	PermanentError = errors.NewWrapper("permanent delivery error")
+	// AttemptsError is returned when every attempt has failed
+	AttemptsError       = errors.NewWrapper("delivery attempts are exhausted")
+	ResponseStatusError = errors.NewWrapper("unexpected response status")
+)
+
+// sleep and random are replaced by tests to check intervals without waiting
+var (
+	sleep = func(ctx context.Context, interval time.Duration) error {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	random = rand.Float64
+)
+
+// Policy is exponential backoff with jitter, zero fields are replaced with defaults by WithDefaults
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter randomizes every interval by +-Jitter part of it, 0.2 by default
+	Jitter float64
+	// MaxAttempts defaults to 10, negative value retries until ctx is done
+	MaxAttempts int
+}
+
+func DefaultPolicy() Policy {
+	return Policy{}.WithDefaults()
+}
+
+func (p Policy) WithDefaults() Policy {
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = defaultInitialInterval
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = defaultMaxInterval
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultMultiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultJitter
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+
+	return p
+}
+
+// Do calls send until it succeeds, returns permanent error, attempts are exhausted or ctx is done,
+// the last send error is returned in every failure case except ctx cancellation
+func (p Policy) Do(ctx context.Context, send func() error) (err error) {
+	interval := p.InitialInterval
+	for attempt := 1; ; attempt++ {
+		err = send()
+		if err == nil || IsPermanent(err) {
+			return
+		}
+
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return AttemptsError.Wrap(err)
+		}
+
+		if err = sleep(ctx, p.jitter(interval)); err != nil {
+			return
+		}
+
+		interval = time.Duration(float64(interval) * p.Multiplier)
+		if interval > p.MaxInterval {
+			interval = p.MaxInterval
+		}
+	}
+}
+
+func (p Policy) jitter(interval time.Duration) time.Duration {
+	delta := float64(interval) * p.Jitter
+	return time.Duration(float64(interval) - delta + random()*2*delta)
+}
+
+func Permanent(err error) error {
+	return PermanentError.Wrap(err)
+}
+
+func IsPermanent(err error) bool {
+	return errors.IsCausedBy(err, PermanentError)
+}
+
+// RetryableStatus classifies http response status, 408, 429 and 5xx are retried while other 4xx are not
+func RetryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// StatusError builds delivery error for unsuccessful http response status
+func StatusError(code int, body string) error {
+	err := ResponseStatusError.NewF("status %d: %s", code, body)
+	if RetryableStatus(code) {
+		return err
+	}
+
+	return Permanent(err)
+}
@@ -0,0 +1,234 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golibs/errors"
+	"golibs/logging"
+)
+
+// fakeSleep records intervals instead of waiting, random is fixed to value
+func fakeSleep(t *testing.T, value float64) *[]time.Duration {
+	var intervals []time.Duration
+	originalSleep, originalRandom := sleep, random
+	t.Cleanup(func() { sleep, random = originalSleep, originalRandom })
+
+	sleep = func(ctx context.Context, interval time.Duration) error {
+		intervals = append(intervals, interval)
+		return ctx.Err()
+	}
+	random = func() float64 { return value }
+
+	return &intervals
+}
+
+func failingSend(calls *int, err error) func() error {
+	return func() error {
+		*calls++
+		return err
+	}
+}
+
+func TestDoBackoffGrowsUpToMaxInterval(t *testing.T) {
+	intervals := fakeSleep(t, 0.5)
+	policy := Policy{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 2, MaxAttempts: 6}.WithDefaults()
+
+	var calls int
+	err := policy.Do(context.Background(), failingSend(&calls, fmt.Errorf("unavailable")))
+
+	if !errors.IsCausedBy(err, AttemptsError) {
+		t.Errorf("error %v is not attempts error", err)
+	}
+	if calls != 6 {
+		t.Errorf("send is called %d times, expected MaxAttempts 6", calls)
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(*intervals, expected) {
+		t.Errorf("intervals %v, expected %v", *intervals, expected)
+	}
+}
+
+func TestDoJitterBounds(t *testing.T) {
+	for _, test := range []struct {
+		random   float64
+		expected time.Duration
+	}{
+		{random: 0, expected: 800 * time.Millisecond},
+		{random: 0.5, expected: time.Second},
+		{random: 0.999, expected: 1199600 * time.Microsecond},
+	} {
+		intervals := fakeSleep(t, test.random)
+		policy := Policy{InitialInterval: time.Second, Jitter: 0.2, MaxAttempts: 2}.WithDefaults()
+
+		var calls int
+		_ = policy.Do(context.Background(), failingSend(&calls, fmt.Errorf("unavailable")))
+
+		if len(*intervals) != 1 || (*intervals)[0] != test.expected {
+			t.Errorf("random %v gave intervals %v, expected %v", test.random, *intervals, test.expected)
+		}
+		if interval := (*intervals)[0]; interval < 800*time.Millisecond || interval > 1200*time.Millisecond {
+			t.Errorf("interval %v is out of +-20%% jitter bounds", interval)
+		}
+	}
+}
+
+func TestDoStopsOnSuccess(t *testing.T) {
+	intervals := fakeSleep(t, 0.5)
+
+	var calls int
+	err := DefaultPolicy().Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("unavailable")
+		}
+		return nil
+	})
+
+	if err != nil || calls != 3 || len(*intervals) != 2 {
+		t.Errorf("error %v after %d calls and %d sleeps, expected success on third call", err, calls, len(*intervals))
+	}
+}
+
+func TestDoDoesNotRetryPermanentError(t *testing.T) {
+	intervals := fakeSleep(t, 0.5)
+
+	var calls int
+	err := DefaultPolicy().Do(context.Background(), failingSend(&calls, Permanent(fmt.Errorf("bad request"))))
+
+	if !IsPermanent(err) || calls != 1 || len(*intervals) != 0 {
+		t.Errorf("permanent error %v is retried: %d calls and %d sleeps", err, calls, len(*intervals))
+	}
+}
+
+func TestDoUnlimitedAttemptsStopOnContext(t *testing.T) {
+	intervals := fakeSleep(t, 0.5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	err := Policy{MaxAttempts: -1}.WithDefaults().Do(ctx, func() error {
+		calls++
+		if calls == 20 {
+			cancel()
+		}
+		return fmt.Errorf("unavailable")
+	})
+
+	if err != context.Canceled || calls != 20 || len(*intervals) != 20 {
+		t.Errorf("error %v after %d calls and %d sleeps, expected cancellation after 20 calls", err, calls, len(*intervals))
+	}
+}
+
+func TestStatusErrorClassification(t *testing.T) {
+	for code, retryable := range map[int]bool{
+		http.StatusBadRequest:            false,
+		http.StatusUnauthorized:          false,
+		http.StatusNotFound:              false,
+		http.StatusRequestEntityTooLarge: false,
+		http.StatusRequestTimeout:        true,
+		http.StatusTooManyRequests:       true,
+		http.StatusInternalServerError:   true,
+		http.StatusServiceUnavailable:    true,
+	} {
+		if RetryableStatus(code) != retryable {
+			t.Errorf("status %d retryable is %t, expected %t", code, !retryable, retryable)
+		}
+
+		err := StatusError(code, "body")
+		if IsPermanent(err) == retryable {
+			t.Errorf("status %d error permanent is %t, expected %t", code, IsPermanent(err), !retryable)
+		}
+		if !strings.Contains(err.Error(), "status "+strconv.Itoa(code)+": body") {
+			t.Errorf("status %d error %v does not keep response body", code, err)
+		}
+	}
+}
+
+func TestDropPassesEntriesToDeadLetter(t *testing.T) {
+	entries := []logging.Entry{{Fields: []logging.LogField{{Name: logging.MessageFieldKey, Value: "lost"}}}}
+	deliveryErr := fmt.Errorf("unavailable")
+
+	var dropped []logging.Entry
+	var droppedErr error
+	Drop(DeadLetterFunc(func(entries []logging.Entry, err error) {
+		dropped, droppedErr = entries, err
+	}), entries, deliveryErr)
+
+	if !reflect.DeepEqual(dropped, entries) || droppedErr != deliveryErr {
+		t.Errorf("dead letter got %v with %v", dropped, droppedErr)
+	}
+}
+
+func TestFileDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead_letter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dropped.log")
+
+	deadLetter, err := NewFileDeadLetter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Drop(deadLetter, []logging.Entry{
+		{Fields: []logging.LogField{{Name: logging.MessageFieldKey, Value: "first"}}},
+		{Fields: []logging.LogField{{Name: logging.MessageFieldKey, Value: "second"}}},
+	}, fmt.Errorf("unavailable"))
+	if err = deadLetter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("dead letter file has %d lines, expected 2", len(lines))
+	}
+	for i, message := range []string{"first", "second"} {
+		var record deadLetterRecord
+		if err = json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Fields[logging.MessageFieldKey] != message || !strings.Contains(record.Error, "unavailable") {
+			t.Errorf("dead letter record %+v, expected %s entry with delivery error", record, message)
+		}
+	}
+}
+
+func TestHealthFollowsLastAttempt(t *testing.T) {
+	var health Health
+	if !health.Healthy() {
+		t.Fatal("zero health is unhealthy")
+	}
+
+	for _, test := range []struct {
+		err     error
+		healthy bool
+	}{
+		{err: fmt.Errorf("connection refused"), healthy: false},
+		{err: nil, healthy: true},
+		{err: StatusError(http.StatusServiceUnavailable, ""), healthy: false},
+		{err: StatusError(http.StatusBadRequest, "invalid entry"), healthy: true},
+	} {
+		if err := health.Record(test.err); err != test.err {
+			t.Errorf("Record returned %v, expected %v", err, test.err)
+		}
+		if health.Healthy() != test.healthy {
+			t.Errorf("health after %v is %t, expected %t", test.err, health.Healthy(), test.healthy)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package syslog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golibs/external/log_drivers/retry"
+	"golibs/external/log_drivers/tls_config"
+	"golibs/logging"
+)
+
+const defaultQueueCapacity = 1000
+
+// NewSyslog creates syslog printer, level is mapped to severity with logging.SyslogSeverity
+func NewSyslog(conf Config) (*syslogWriter, error) {
+	conf = withDefaults(conf)
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+
+	result := &syslogWriter{
+		conf:       conf,
+		connection: &connection{conf: conf},
+		retry:      conf.Retry.WithDefaults(),
+		formatter: formatter{
+			format:   conf.Format,
+			facility: conf.Facility,
+			hostName: header(conf.HostName, maxHostNameLength),
+			appName:  header(conf.AppName, maxAppNameLength),
+			procID:   strconv.Itoa(os.Getpid()),
+			sdID:     conf.StructuredDataID,
+		},
+	}
+	if conf.Format == RFC3164 {
+		result.formatter.appName = header(conf.AppName, maxTagLength)
+	}
+
+	if conf.Transport == TLS {
+		tlsConf, err := tls_config.New(conf.TLS, conf.Addr)
+		if err != nil {
+			return nil, err
+		}
+		result.connection.tls = tlsConf
+	}
+
+	queue, err := logging.NewQueue(conf.Queue.WithDefaults(defaultQueueCapacity, logging.OverflowDropNewest), result.sendWithRetry)
+	if err != nil {
+		return nil, err
+	}
+	result.queue = queue
+
+	return result, nil
+}
+
+func withDefaults(conf Config) Config {
+	if conf.Transport == "" {
+		conf.Transport = UDP
+	}
+	if conf.Transport == UNIX && conf.Addr == "" {
+		conf.Addr = DefaultSocket
+	}
+	if conf.Format == "" {
+		conf.Format = RFC5424
+	}
+	if conf.Framing == "" {
+		conf.Framing = OctetCounting
+	}
+	if conf.Facility == 0 {
+		conf.Facility = UserFacility
+	}
+	if conf.HostName == "" {
+		conf.HostName, _ = os.Hostname()
+	}
+	if conf.AppName == "" {
+		conf.AppName = filepath.Base(os.Args[0])
+	}
+	if conf.StructuredDataID == "" {
+		conf.StructuredDataID = DefaultStructuredDataID
+	}
+	if conf.MaxDatagramSize == 0 {
+		conf.MaxDatagramSize = DefaultMaxDatagramSize
+	}
+
+	return conf
+}
+
+type syslogWriter struct {
+	conf       Config
+	queue      *logging.Queue
+	connection *connection
+	formatter  formatter
+	retry      retry.Policy
+	health     retry.Health
+}
+
+func (s *syslogWriter) sendWithRetry(ctx context.Context, entry logging.Entry) {
+	message := s.formatter.Format(entry)
+
+	err := s.retry.Do(ctx, func() error {
+		return s.health.Record(s.connection.write(message))
+	})
+	if err != nil {
+		retry.Drop(s.conf.DeadLetter, []logging.Entry{entry}, err)
+	}
+}
+
+func (s *syslogWriter) Print(entry string, fields []logging.LogField) {
+	s.queue.Push(logging.Entry{Text: entry, Fields: fields})
+}
+
+func (s *syslogWriter) Flush(ctx context.Context) error {
+	return s.queue.Flush(ctx)
+}
+
+func (s *syslogWriter) Close() error {
+	err := s.queue.Close()
+
+	if closeErr := s.connection.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (s *syslogWriter) Stats() logging.QueueStats {
+	return s.queue.Stats()
+}
+
+// Healthy reports whether the last message was written to syslog connection
+func (s *syslogWriter) Healthy() bool {
+	return s.health.Healthy()
+}
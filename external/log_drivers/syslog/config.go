@@ -0,0 +1,106 @@
+package syslog
+
+import (
+	"golibs/external/log_drivers/retry"
+	"golibs/external/log_drivers/tls_config"
+	"golibs/logging"
+)
+
+type Transport string
+
+const (
+	UDP  Transport = "UDP"
+	TCP  Transport = "TCP"
+	TLS  Transport = "TLS"
+	UNIX Transport = "UNIX"
+)
+
+type Format string
+
+const (
+	RFC5424 Format = "RFC5424"
+	RFC3164 Format = "RFC3164"
+)
+
+type Framing string
+
+const (
+	// OctetCounting prefixes stream messages with their length as described in RFC 6587
+	OctetCounting Framing = "OCTET_COUNTING"
+	// NonTransparent terminates stream messages with LF, messages must not contain LF
+	NonTransparent Framing = "NON_TRANSPARENT"
+)
+
+const (
+	// DefaultSocket is local syslog socket used by UNIX transport
+	DefaultSocket = "/dev/log"
+	// DefaultStructuredDataID is SD-ID of log fields element, 32473 is enterprise number reserved for examples
+	DefaultStructuredDataID = "fields@32473"
+	// UserFacility is syslog facility for user-level messages
+	UserFacility = 1
+	// DefaultMaxDatagramSize is default message size limit of rsyslog and syslog-ng
+	DefaultMaxDatagramSize = 8192
+	maxUdpPayload          = 65507
+)
+
+type Config struct {
+	// Transport defaults to UDP
+	Transport Transport
+	// Addr is host:port for network transports, UNIX transport defaults to /dev/log
+	Addr    string
+	TimeOut int
+	// Format defaults to RFC5424 where log fields are sent as structured data, RFC3164 sends formatted entry
+	Format Format
+	// Framing of TCP and TLS messages defaults to octet counting
+	Framing Framing
+	// Facility defaults to user-level messages, kernel facility 0 can not be used
+	Facility         int
+	HostName         string
+	AppName          string
+	StructuredDataID string
+	// MaxDatagramSize truncates longer UDP and unix datagram messages, which can not be sent whole,
+	// defaults to DefaultMaxDatagramSize
+	MaxDatagramSize int
+	TLS             tls_config.Config
+	Queue           logging.QueueConfig
+	Retry           retry.Policy
+	DeadLetter      retry.DeadLetter
+}
+
+func (c Config) validate() error {
+	switch c.Transport {
+	case UDP, TCP, TLS, UNIX:
+	default:
+		return ConfigError.NewF("unknown syslog transport %q, expected one of UDP, TCP, TLS, UNIX", string(c.Transport))
+	}
+
+	if c.Addr == "" {
+		return ConfigError.New("syslog address is required")
+	}
+
+	switch c.Format {
+	case RFC5424, RFC3164:
+	default:
+		return ConfigError.NewF("unknown syslog format %q, expected one of RFC5424, RFC3164", string(c.Format))
+	}
+
+	switch c.Framing {
+	case OctetCounting, NonTransparent:
+	default:
+		return ConfigError.NewF("unknown syslog framing %q, expected one of OCTET_COUNTING, NON_TRANSPARENT", string(c.Framing))
+	}
+
+	if c.Facility < 0 || c.Facility > 23 {
+		return ConfigError.NewF("syslog facility must be between 0 and 23, got %d", c.Facility)
+	}
+
+	if c.MaxDatagramSize <= 0 || c.MaxDatagramSize > maxUdpPayload {
+		return ConfigError.NewF("max datagram size must be between 1 and %d, got %d", maxUdpPayload, c.MaxDatagramSize)
+	}
+
+	if !validName(c.StructuredDataID) {
+		return ConfigError.NewF("invalid structured data id %q", c.StructuredDataID)
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+package syslog
+
+import "golibs/errors"
+
+var (
+	ConfigError     = errors.NewWrapper("invalid syslog config", errors.ValidationErrorType)
+	ConnectionError = errors.NewWrapper("syslog connection error")
+)
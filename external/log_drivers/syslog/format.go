@@ -0,0 +1,124 @@
+package syslog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golibs/logging"
+)
+
+const (
+	nilValue          = "-"
+	maxNameLength     = 32
+	maxHostNameLength = 255
+	maxAppNameLength  = 48
+	maxTagLength      = 32
+)
+
+type formatter struct {
+	format   Format
+	facility int
+	hostName string
+	appName  string
+	procID   string
+	sdID     string
+}
+
+func (f formatter) Format(entry logging.Entry) string {
+	priority := f.facility*8 + logging.SyslogSeverity(logging.Level(logging.FieldString(entry.Fields, logging.LogLvlFieldKey)))
+	ts := logging.EntryTime(entry.Fields)
+
+	// RFC3164 TIMESTAMP has no time zone, receivers read it as local time
+	if f.format == RFC3164 {
+		return fmt.Sprintf("<%d>%s %s %s[%s]: %s", priority, ts.Local().Format(time.Stamp), f.hostName, f.appName, f.procID, entry.Text)
+	}
+
+	message := logging.FieldString(entry.Fields, logging.MessageFieldKey)
+	if message != "" {
+		message = " " + message
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s - %s%s",
+		priority, ts.Format("2006-01-02T15:04:05.000000Z07:00"), f.hostName, f.appName, f.procID, f.structuredData(entry.Fields), message)
+}
+
+// structuredData renders log fields as single SD-ELEMENT, names are sanitized and the last value wins
+func (f formatter) structuredData(fields []logging.LogField) string {
+	var sd strings.Builder
+	last := make(map[string]int, len(fields))
+	names := make([]string, len(fields))
+
+	for i, field := range fields {
+		switch field.Name {
+		case logging.LogLvlFieldKey, logging.MessageFieldKey, logging.TimeFieldKey:
+			continue
+		}
+		names[i] = paramName(field.Name)
+		last[names[i]] = i
+	}
+
+	for i, field := range fields {
+		if names[i] == "" || last[names[i]] != i {
+			continue
+		}
+
+		sd.WriteString(" ")
+		sd.WriteString(names[i])
+		sd.WriteString(`="`)
+		sd.WriteString(paramValue(logging.FormatValue(field.Value)))
+		sd.WriteString(`"`)
+	}
+
+	if sd.Len() == 0 {
+		return nilValue
+	}
+
+	return "[" + f.sdID + sd.String() + "]"
+}
+
+// paramName keeps printable US-ASCII except '=', ' ', ']' and '"', names are limited to 32 characters
+func paramName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if sanitized == "" {
+		sanitized = "_"
+	}
+	if len(sanitized) > maxNameLength {
+		sanitized = sanitized[:maxNameLength]
+	}
+
+	return sanitized
+}
+
+func paramValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// header sanitizes HOSTNAME and APP-NAME, they can not contain spaces or be empty
+func header(value string, limit int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if value == "" {
+		return nilValue
+	}
+	if len(value) > limit {
+		value = value[:limit]
+	}
+
+	return value
+}
+
+func validName(name string) bool {
+	return name != "" && paramName(name) == name
+}
@@ -0,0 +1,50 @@
+package syslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golibs/logging"
+)
+
+func TestFormatRFC3164UsesLocalTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+3", 3*60*60)
+	defer func() { time.Local = local }()
+
+	f := formatter{format: RFC3164, facility: UserFacility, hostName: "host", appName: "app", procID: "1"}
+	got := f.Format(logging.Entry{Text: "hello", Fields: []logging.LogField{
+		{Name: logging.LogLvlFieldKey, Value: "INFO"},
+		{Name: logging.TimeFieldKey, Value: "2024-01-02T21:04:05Z"},
+	}})
+
+	if expected := "<14>Jan  3 00:04:05 host app[1]: hello"; got != expected {
+		t.Errorf("message is %q, expected %q", got, expected)
+	}
+}
+
+func TestFormatRFC5424StructuredData(t *testing.T) {
+	f := formatter{format: RFC5424, facility: UserFacility, hostName: "host", appName: "app", procID: "1", sdID: DefaultStructuredDataID}
+	got := f.Format(logging.Entry{Fields: []logging.LogField{
+		{Name: logging.LogLvlFieldKey, Value: "ERROR"},
+		{Name: logging.TimeFieldKey, Value: "2024-01-02T21:04:05Z"},
+		{Name: logging.MessageFieldKey, Value: "failed"},
+		{Name: "user id", Value: 7},
+		{Name: "path", Value: `a"]`},
+	}})
+
+	expected := `<11>1 2024-01-02T21:04:05.000000Z host app 1 - [fields@32473 user_id="7" path="a\"\]"] failed`
+	if got != expected {
+		t.Errorf("message is %q, expected %q", got, expected)
+	}
+}
+
+func TestTruncateKeepsRunes(t *testing.T) {
+	if got := truncate("abc", 5); got != "abc" {
+		t.Errorf("short message is truncated to %q", got)
+	}
+	if got := truncate(strings.Repeat("я", 3), 3); got != "я" {
+		t.Errorf("message is truncated to %q", got)
+	}
+}
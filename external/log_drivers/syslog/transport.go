@@ -0,0 +1,131 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultTimeOut = 10
+
+// connection writes framed messages and reconnects after write errors, it is safe for concurrent use
+type connection struct {
+	mu      sync.Mutex
+	conf    Config
+	tls     *tls.Config
+	conn    net.Conn
+	framing Framing
+	closed  bool
+}
+
+func (c *connection) write(message string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ConnectionError.New("syslog connection is closed")
+	}
+
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return ConnectionError.Wrap(err)
+		}
+	}
+
+	// write fails after timeout when syslog server stops reading, so stalled peer does not hang the queue
+	err := c.conn.SetWriteDeadline(time.Now().Add(c.timeOut()))
+	if err == nil {
+		_, err = c.conn.Write(c.frame(message))
+	}
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		return ConnectionError.Wrap(err)
+	}
+
+	return nil
+}
+
+// frame applies RFC 6587 framing for stream connections, datagrams carry single message without framing
+// truncated to MaxDatagramSize, otherwise the write fails the same way on every retry
+func (c *connection) frame(message string) []byte {
+	switch c.framing {
+	case OctetCounting:
+		return []byte(strconv.Itoa(len(message)) + " " + message)
+	case NonTransparent:
+		return []byte(strings.Replace(message, "\n", " ", -1) + "\n")
+	}
+
+	return []byte(truncate(message, c.conf.MaxDatagramSize))
+}
+
+// truncate cuts message to limit bytes without splitting UTF-8 sequence
+func truncate(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+
+	for limit > 0 && !utf8.RuneStart(message[limit]) {
+		limit--
+	}
+
+	return message[:limit]
+}
+
+func (c *connection) timeOut() time.Duration {
+	if c.conf.TimeOut <= 0 {
+		return time.Second * defaultTimeOut
+	}
+
+	return time.Second * time.Duration(c.conf.TimeOut)
+}
+
+func (c *connection) dial() (err error) {
+	dialer := &net.Dialer{Timeout: c.timeOut()}
+
+	c.framing = ""
+	switch c.conf.Transport {
+	case UDP:
+		c.conn, err = dialer.Dial("udp", c.conf.Addr)
+	case TCP:
+		c.conn, err = dialer.Dial("tcp", c.conf.Addr)
+		c.framing = c.conf.Framing
+	case TLS:
+		c.conn, err = tls.DialWithDialer(dialer, "tcp", c.conf.Addr, c.tls)
+		c.framing = c.conf.Framing
+	case UNIX:
+		// local syslog daemons listen on datagram socket, stream socket is used as fallback
+		c.conn, err = dialer.Dial("unixgram", c.conf.Addr)
+		if err != nil {
+			c.conn, err = dialer.Dial("unix", c.conf.Addr)
+			c.framing = NonTransparent
+		}
+	}
+	if err != nil {
+		c.conn = nil
+	}
+
+	return
+}
+
+func (c *connection) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	if err != nil {
+		return ConnectionError.Wrap(err)
+	}
+
+	return nil
+}
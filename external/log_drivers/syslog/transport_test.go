@@ -0,0 +1,84 @@
+package syslog
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnectionTruncatesDatagrams(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	c := &connection{conf: Config{Transport: UDP, Addr: listener.LocalAddr().String(), MaxDatagramSize: 100}}
+	defer c.close()
+
+	if err = c.write(strings.Repeat("x", 70000)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65536)
+	if err = listener.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := listener.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Errorf("datagram of %d bytes is received, expected 100", n)
+	}
+}
+
+func TestConnectionWriteDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// peer accepts connection but never reads, so socket buffers fill up
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	c := &connection{conf: Config{Transport: TCP, Framing: OctetCounting, Addr: listener.Addr().String(), TimeOut: 1}}
+	defer c.close()
+
+	message := strings.Repeat("x", 1<<20)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			if err := c.write(message); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	conn := <-accepted
+	defer conn.Close()
+
+	select {
+	case err = <-done:
+		if !strings.Contains(err.Error(), "timeout") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("write to stalled peer does not time out")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		t.Error("connection is kept after write timeout, expected reconnect on the next write")
+	}
+}
@@ -0,0 +1,81 @@
+// Package tls_config builds client TLS configs of log drivers
+package tls_config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+
+	"golibs/errors"
+)
+
+var ConfigError = errors.NewWrapper("invalid tls config", errors.ValidationErrorType)
+
+// Config verifies server certificate by default, InsecureSkipVerify disables verification explicitly
+type Config struct {
+	// Enabled turns on TLS without other settings for drivers where TLS is optional
+	Enabled bool
+	// CAFile is PEM bundle verifying server, RootCAs are used when set and system pool otherwise
+	CAFile  string
+	RootCAs *x509.CertPool
+	// CertFile and KeyFile are PEM client certificate and key, they are added to Certificates
+	CertFile     string
+	KeyFile      string
+	Certificates []tls.Certificate
+	// ServerName defaults to host of driver address
+	ServerName string
+	// MinVersion defaults to tls.VersionTLS12
+	MinVersion         uint16
+	InsecureSkipVerify bool
+}
+
+// IsSet reports whether any setting is present
+func (c Config) IsSet() bool {
+	return c.Enabled || c.CAFile != "" || c.RootCAs != nil || c.CertFile != "" || c.KeyFile != "" ||
+		len(c.Certificates) > 0 || c.ServerName != "" || c.MinVersion != 0 || c.InsecureSkipVerify
+}
+
+// New returns client config for addr, empty addr keeps ServerName empty so http transport takes it from url
+func New(conf Config, addr string) (*tls.Config, error) {
+	tlsConf := &tls.Config{
+		RootCAs:            conf.RootCAs,
+		Certificates:       append([]tls.Certificate(nil), conf.Certificates...),
+		ServerName:         conf.ServerName,
+		MinVersion:         conf.MinVersion,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if tlsConf.MinVersion == 0 {
+		tlsConf.MinVersion = tls.VersionTLS12
+	}
+	if tlsConf.ServerName == "" && addr != "" {
+		tlsConf.ServerName = addr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			tlsConf.ServerName = host
+		}
+	}
+
+	if conf.CAFile != "" {
+		pem, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, ConfigError.Wrap(err)
+		}
+
+		if tlsConf.RootCAs == nil {
+			tlsConf.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, ConfigError.NewF("no certificates found in CA file %s", conf.CAFile)
+		}
+	}
+
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, ConfigError.Wrap(err)
+		}
+		tlsConf.Certificates = append(tlsConf.Certificates, cert)
+	}
+
+	return tlsConf, nil
+}
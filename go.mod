@@ -3,8 +3,6 @@ module golibs
 go 1.14
 
 require (
-	github.com/Devatoria/go-graylog v0.0.0-20171023211614-c16c35c9383b
-	github.com/Jeffail/gabs v1.4.0 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/satori/go.uuid v1.2.0
 )
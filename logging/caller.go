@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"path"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const maxStackDepth = 32
+
+// loggingPackage is prefix of function names inside this package, their frames are skipped when looking for caller
+var loggingPackage = func() string {
+	name := runtime.FuncForPC(reflect.ValueOf(NewLogger).Pointer()).Name()
+	return name[:strings.LastIndex(name, ".")+1]
+}()
+
+// callerFields returns caller and function of the first frame outside logger skipping extra wrapper frames,
+// stack is added when withStack is set
+func callerFields(skip int, withCaller, withStack bool) []LogField {
+	pcs := make([]uintptr, maxStackDepth+skip+8)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	var fields []LogField
+	var stack strings.Builder
+	inLogger := true
+	for depth := 0; depth < maxStackDepth; {
+		frame, more := frames.Next()
+
+		switch {
+		case inLogger && strings.HasPrefix(frame.Function, loggingPackage):
+		case skip > 0:
+			inLogger = false
+			skip--
+		default:
+			inLogger = false
+			if depth == 0 && withCaller {
+				fields = append(fields,
+					LogField{Name: CallerFieldKey, Value: shortPath(frame.File) + ":" + strconv.Itoa(frame.Line)},
+					LogField{Name: FunctionFieldKey, Value: frame.Function},
+				)
+			}
+			if !withStack {
+				return fields
+			}
+
+			stack.WriteString(frame.Function + "\n\t" + frame.File + ":" + strconv.Itoa(frame.Line) + "\n")
+			depth++
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	if stack.Len() > 0 {
+		fields = append(fields, LogField{Name: StackFieldKey, Value: strings.TrimSuffix(stack.String(), "\n")})
+	}
+
+	return fields
+}
+
+// shortPath keeps package directory and file name, frame paths always use forward slashes
+func shortPath(file string) string {
+	dir, name := path.Split(file)
+	return path.Join(path.Base(dir), name)
+}
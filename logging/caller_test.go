@@ -0,0 +1,60 @@
+package logging_test
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"golibs/logging"
+)
+
+// nextLine returns caller field expected for the line after the call
+func nextLine() string {
+	_, file, line, _ := runtime.Caller(1)
+	return filepath.Base(filepath.Dir(file)) + "/" + filepath.Base(file) + ":" + strconv.Itoa(line+1)
+}
+
+func TestCallerFieldsPointToCallSite(t *testing.T) {
+	logger, recorder := newLogger(t, logging.Config{Caller: true})
+	replicated := logger.Replicate()
+
+	var expected []string
+	expected = append(expected, nextLine())
+	logger.Info("info")
+	expected = append(expected, nextLine())
+	logger.Error(errors.New("failed"))
+	expected = append(expected, nextLine())
+	logger.WithField("user", "alice").Warn("with field")
+	expected = append(expected, nextLine())
+	replicated.Info("replicated")
+
+	entries := recorder.Entries()
+	if len(entries) != len(expected) {
+		t.Fatalf("%d entries are logged, expected %d", len(entries), len(expected))
+	}
+	for i, entry := range entries {
+		if caller, _ := entry.Field(logging.CallerFieldKey); caller != expected[i] {
+			t.Errorf("entry %q has caller %v, expected %s", entry.Message, caller, expected[i])
+		}
+		if function, _ := entry.Field(logging.FunctionFieldKey); function != "golibs/logging_test.TestCallerFieldsPointToCallSite" {
+			t.Errorf("entry %q has function %v", entry.Message, function)
+		}
+	}
+}
+
+func TestCallerSkipsWrapperFrames(t *testing.T) {
+	logger, recorder := newLogger(t, logging.Config{Caller: true, CallerSkip: 1})
+	warn := func(msg string) {
+		logger.Warn(msg)
+	}
+
+	expected := nextLine()
+	warn("wrapped")
+
+	entry := recorder.AssertLogged(t, logging.WarningLevel, "wrapped", nil)
+	if caller, _ := entry.Field(logging.CallerFieldKey); caller != expected {
+		t.Errorf("wrapped entry has caller %v, expected %s", caller, expected)
+	}
+}
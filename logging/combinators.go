@@ -0,0 +1,307 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	teeQueueCapacity      = 1000
+	fallbackProbeInterval = 5 * time.Second
+)
+
+// Predicate decides whether entry with fields is printed
+type Predicate func(fields []LogField) bool
+
+// formatterBinder is implemented by printers which need logger format, AddPrinter binds it
+type formatterBinder interface {
+	bindFormatter(formatter Formatter)
+}
+
+// Healthy is implemented by remote printers reporting whether they can deliver entries, it is called
+// for every entry by fallback printer and must not wait for network
+type Healthy interface {
+	Healthy() bool
+}
+
+// LevelAtLeast matches entries of level and above
+func LevelAtLeast(level Level) Predicate {
+	return func(fields []LogField) bool {
+		return Level(FieldString(fields, LogLvlFieldKey)).Enabled(level)
+	}
+}
+
+// LevelIn matches entries of listed levels
+func LevelIn(levels ...Level) Predicate {
+	allowed := make(map[Level]bool, len(levels))
+	for _, level := range levels {
+		allowed[level] = true
+	}
+
+	return func(fields []LogField) bool {
+		return allowed[Level(FieldString(fields, LogLvlFieldKey))]
+	}
+}
+
+// HasField matches entries containing field with name
+func HasField(name string) Predicate {
+	return func(fields []LogField) bool {
+		_, ok := FieldValue(fields, name)
+		return ok
+	}
+}
+
+// FieldEquals matches entries where the last field with name has value, values are compared as printed strings
+func FieldEquals(name string, value interface{}) Predicate {
+	expected := FormatValue(value)
+
+	return func(fields []LogField) bool {
+		actual, ok := FieldValue(fields, name)
+		return ok && FormatValue(actual) == expected
+	}
+}
+
+// Not negates predicate
+func Not(predicate Predicate) Predicate {
+	return func(fields []LogField) bool {
+		return !predicate(fields)
+	}
+}
+
+type multiPrinter struct {
+	printers []Printer
+}
+
+// NewMultiPrinter prints every entry to each printer in order, panicking printer does not skip the rest
+func NewMultiPrinter(printers ...Printer) Printer {
+	return &multiPrinter{printers: printers}
+}
+
+func (m *multiPrinter) Print(entry string, fields []LogField) {
+	for _, printer := range m.printers {
+		printIsolated(printer, Entry{Text: entry, Fields: fields})
+	}
+}
+
+func (m *multiPrinter) bindFormatter(formatter Formatter) {
+	for _, printer := range m.printers {
+		bindFormatter(printer, formatter)
+	}
+}
+
+func (m *multiPrinter) Flush(ctx context.Context) error {
+	return flushAll(ctx, m.printers)
+}
+
+func (m *multiPrinter) Close() error {
+	return closeAll(m.printers)
+}
+
+type filterPrinter struct {
+	printer   Printer
+	predicate Predicate
+}
+
+// NewFilterPrinter prints entries matching predicate, use it with NewMultiPrinter to route entries by level or fields
+func NewFilterPrinter(printer Printer, predicate Predicate) Printer {
+	return &filterPrinter{printer: printer, predicate: predicate}
+}
+
+func (f *filterPrinter) Print(entry string, fields []LogField) {
+	if f.predicate(fields) {
+		f.printer.Print(entry, fields)
+	}
+}
+
+func (f *filterPrinter) bindFormatter(formatter Formatter) {
+	bindFormatter(f.printer, formatter)
+}
+
+func (f *filterPrinter) Flush(ctx context.Context) error {
+	return Flush(ctx, f.printer)
+}
+
+func (f *filterPrinter) Close() error {
+	return Close(f.printer)
+}
+
+type teePrinter struct {
+	printers []Printer
+	queues   []*Queue
+}
+
+// NewTeePrinter prints every entry to each printer from its own queue, so slow, blocking or panicking printer
+// does not delay or break the others, queues default to 1000 entries dropping the newest ones when full
+func NewTeePrinter(conf QueueConfig, printers ...Printer) (Printer, error) {
+	tee := &teePrinter{printers: printers}
+
+	for _, printer := range printers {
+		printer := printer
+		queue, err := NewQueue(conf.WithDefaults(teeQueueCapacity, OverflowDropNewest), func(_ context.Context, entry Entry) {
+			printIsolated(printer, entry)
+		})
+		if err != nil {
+			for _, created := range tee.queues {
+				_ = created.Close()
+			}
+			return nil, err
+		}
+		tee.queues = append(tee.queues, queue)
+	}
+
+	return tee, nil
+}
+
+func (t *teePrinter) Print(entry string, fields []LogField) {
+	for _, queue := range t.queues {
+		queue.Push(Entry{Text: entry, Fields: fields})
+	}
+}
+
+func (t *teePrinter) bindFormatter(formatter Formatter) {
+	for _, printer := range t.printers {
+		bindFormatter(printer, formatter)
+	}
+}
+
+// Flush waits for every branch queue and flushes printers
+func (t *teePrinter) Flush(ctx context.Context) (err error) {
+	for _, queue := range t.queues {
+		if flushErr := queue.Flush(ctx); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+
+	if flushErr := flushAll(ctx, t.printers); flushErr != nil && err == nil {
+		err = flushErr
+	}
+
+	return
+}
+
+// Close closes branch queues waiting up to DefaultDrainTimeout for each and closes printers
+func (t *teePrinter) Close() (err error) {
+	for _, queue := range t.queues {
+		if closeErr := queue.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	if closeErr := closeAll(t.printers); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+// Stats sums branch queue stats
+func (t *teePrinter) Stats() (stats QueueStats) {
+	for _, queue := range t.queues {
+		queueStats := queue.Stats()
+		stats.Queued += queueStats.Queued
+		stats.Spilled += queueStats.Spilled
+		stats.Dropped += queueStats.Dropped
+		stats.Evicted += queueStats.Evicted
+	}
+
+	return
+}
+
+type fallbackPrinter struct {
+	// lastProbe is unix time in nanoseconds of the last entry sent to unhealthy primary, it is first for atomic alignment
+	lastProbe     int64
+	probeInterval time.Duration
+	primary       Printer
+	fallback      Printer
+	healthy       func() bool
+}
+
+// NewFallbackPrinter prints to fallback printer, e.g. console or file, while primary printer is unhealthy,
+// healthy defaults to primary Healthy method and primary is always used when neither is available.
+// healthy is called for every entry and must not block. While primary is unhealthy one entry per
+// fallbackProbeInterval is printed to both printers, so primary gets a chance to deliver it and recover
+func NewFallbackPrinter(primary, fallback Printer, healthy func() bool) Printer {
+	if healthy == nil {
+		if checker, ok := primary.(Healthy); ok {
+			healthy = checker.Healthy
+		} else {
+			healthy = func() bool { return true }
+		}
+	}
+
+	return &fallbackPrinter{primary: primary, fallback: fallback, healthy: healthy, probeInterval: fallbackProbeInterval}
+}
+
+func (f *fallbackPrinter) Print(entry string, fields []LogField) {
+	if f.healthy() {
+		f.primary.Print(entry, fields)
+		return
+	}
+
+	f.fallback.Print(entry, fields)
+	if f.probe() {
+		f.primary.Print(entry, fields)
+	}
+}
+
+// probe reports whether probe interval passed since the last probe, only one concurrent caller gets true
+func (f *fallbackPrinter) probe() bool {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&f.lastProbe)
+	if now-last < int64(f.probeInterval) {
+		return false
+	}
+
+	return atomic.CompareAndSwapInt64(&f.lastProbe, last, now)
+}
+
+func (f *fallbackPrinter) bindFormatter(formatter Formatter) {
+	bindFormatter(f.primary, formatter)
+	bindFormatter(f.fallback, formatter)
+}
+
+func (f *fallbackPrinter) Flush(ctx context.Context) error {
+	return flushAll(ctx, []Printer{f.primary, f.fallback})
+}
+
+func (f *fallbackPrinter) Close() error {
+	return closeAll([]Printer{f.primary, f.fallback})
+}
+
+func bindFormatter(printer Printer, formatter Formatter) {
+	if binder, ok := printer.(formatterBinder); ok {
+		binder.bindFormatter(formatter)
+	}
+}
+
+func printIsolated(printer Printer, entry Entry) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			printQueueError(fmt.Errorf("%v", recovered), "printer panicked during printing log entry")
+		}
+	}()
+
+	printer.Print(entry.Text, entry.Fields)
+}
+
+func flushAll(ctx context.Context, printers []Printer) (err error) {
+	for _, printer := range printers {
+		if flushErr := Flush(ctx, printer); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+
+	return
+}
+
+func closeAll(printers []Printer) (err error) {
+	for _, printer := range printers {
+		if closeErr := Close(printer); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return
+}
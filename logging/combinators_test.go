@@ -0,0 +1,195 @@
+package logging
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingPrinter struct {
+	printed int32
+	healthy int32
+}
+
+func (p *countingPrinter) Print(string, []LogField) {
+	atomic.AddInt32(&p.printed, 1)
+}
+
+func (p *countingPrinter) Healthy() bool {
+	return atomic.LoadInt32(&p.healthy) == 1
+}
+
+func TestFallbackPrinterProbesUnhealthyPrimary(t *testing.T) {
+	primary, fallback := &countingPrinter{}, &countingPrinter{}
+	printer := NewFallbackPrinter(primary, fallback, nil).(*fallbackPrinter)
+	printer.probeInterval = time.Hour
+
+	for i := 0; i < 3; i++ {
+		printer.Print("entry", nil)
+	}
+	if primary.printed != 1 || fallback.printed != 3 {
+		t.Fatalf("unhealthy primary got %d entries and fallback %d, expected 1 probe and 3", primary.printed, fallback.printed)
+	}
+
+	// primary delivered probe entry and recovered
+	atomic.StoreInt32(&primary.healthy, 1)
+	printer.Print("entry", nil)
+	if primary.printed != 2 || fallback.printed != 3 {
+		t.Errorf("recovered primary got %d entries and fallback %d, expected 2 and 3", primary.printed, fallback.printed)
+	}
+}
+
+// recordingPrinter keeps printed entries, gate blocks Print until it is closed when set
+type recordingPrinter struct {
+	mu      sync.Mutex
+	entries []string
+	gate    chan struct{}
+}
+
+func (p *recordingPrinter) Print(entry string, _ []LogField) {
+	if p.gate != nil {
+		<-p.gate
+	}
+
+	p.mu.Lock()
+	p.entries = append(p.entries, entry)
+	p.mu.Unlock()
+}
+
+func (p *recordingPrinter) printed() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.entries...)
+}
+
+type panickingPrinter struct{}
+
+func (panickingPrinter) Print(string, []LogField) {
+	panic("printer is broken")
+}
+
+func levelFields(level Level, extra ...LogField) []LogField {
+	return append([]LogField{{Name: LogLvlFieldKey, Value: string(level)}}, extra...)
+}
+
+func TestFallbackPrinterSwitchesByHealth(t *testing.T) {
+	primary, fallback := &recordingPrinter{}, &recordingPrinter{}
+	var healthy int32 = 1
+	printer := NewFallbackPrinter(primary, fallback, func() bool {
+		return atomic.LoadInt32(&healthy) == 1
+	}).(*fallbackPrinter)
+	printer.probeInterval = time.Hour
+
+	printer.Print("a", nil)
+	atomic.StoreInt32(&healthy, 0)
+	printer.Print("b", nil)
+	printer.Print("c", nil)
+	atomic.StoreInt32(&healthy, 1)
+	printer.Print("d", nil)
+
+	if entries := primary.printed(); !reflect.DeepEqual(entries, []string{"a", "b", "d"}) {
+		t.Errorf("primary printed %v, expected healthy entries and one probe", entries)
+	}
+	if entries := fallback.printed(); !reflect.DeepEqual(entries, []string{"b", "c"}) {
+		t.Errorf("fallback printed %v, expected entries printed while primary was unhealthy", entries)
+	}
+}
+
+func TestFallbackPrinterWithoutHealthCheckUsesPrimary(t *testing.T) {
+	primary, fallback := &recordingPrinter{}, &recordingPrinter{}
+	printer := NewFallbackPrinter(primary, fallback, nil)
+
+	printer.Print("a", nil)
+	if len(primary.printed()) != 1 || len(fallback.printed()) != 0 {
+		t.Errorf("primary printed %v and fallback %v, expected primary without Healthy to be used", primary.printed(), fallback.printed())
+	}
+}
+
+func TestFilterPrinterRoutesEntries(t *testing.T) {
+	errorsPrinter, auditPrinter, restPrinter := &recordingPrinter{}, &recordingPrinter{}, &recordingPrinter{}
+	printer := NewMultiPrinter(
+		NewFilterPrinter(errorsPrinter, LevelAtLeast(ErrorLevel)),
+		NewFilterPrinter(auditPrinter, FieldEquals("audit", true)),
+		NewFilterPrinter(restPrinter, Not(LevelIn(ErrorLevel, PanicLevel))),
+	)
+
+	printer.Print("debug", levelFields(DebugLevel))
+	printer.Print("error", levelFields(ErrorLevel))
+	printer.Print("panic", levelFields(PanicLevel))
+	printer.Print("audit", levelFields(InfoLevel, LogField{Name: "audit", Value: true}))
+	printer.Print("not audit", levelFields(InfoLevel, LogField{Name: "audit", Value: false}))
+
+	for _, test := range []struct {
+		name     string
+		printer  *recordingPrinter
+		expected []string
+	}{
+		{name: "errors", printer: errorsPrinter, expected: []string{"error", "panic"}},
+		{name: "audit", printer: auditPrinter, expected: []string{"audit"}},
+		{name: "rest", printer: restPrinter, expected: []string{"debug", "audit", "not audit"}},
+	} {
+		if entries := test.printer.printed(); !reflect.DeepEqual(entries, test.expected) {
+			t.Errorf("%s printer got %v, expected %v", test.name, entries, test.expected)
+		}
+	}
+}
+
+func TestTeePrinterIsolatesBlockedPrinter(t *testing.T) {
+	blocked, fast := &recordingPrinter{gate: make(chan struct{})}, &recordingPrinter{}
+	printer, err := NewTeePrinter(QueueConfig{}, blocked, fast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(printer)
+
+	for _, entry := range []string{"a", "b", "c"} {
+		printer.Print(entry, nil)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(fast.printed()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("fast printer got %v while the other one is blocked", fast.printed())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(blocked.gate)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = Flush(ctx, printer); err != nil {
+		t.Fatal(err)
+	}
+	if entries := blocked.printed(); !reflect.DeepEqual(entries, []string{"a", "b", "c"}) {
+		t.Errorf("released printer got %v, expected every entry in order", entries)
+	}
+}
+
+func TestCombinatorsIsolatePanickingPrinter(t *testing.T) {
+	multiTarget, teeTarget := &recordingPrinter{}, &recordingPrinter{}
+	tee, err := NewTeePrinter(QueueConfig{}, panickingPrinter{}, teeTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(tee)
+
+	NewMultiPrinter(panickingPrinter{}, multiTarget).Print("multi", nil)
+	tee.Print("tee", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = Flush(ctx, tee); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := multiTarget.printed(); !reflect.DeepEqual(entries, []string{"multi"}) {
+		t.Errorf("multi printer after panicking one got %v", entries)
+	}
+	if entries := teeTarget.printed(); !reflect.DeepEqual(entries, []string{"tee"}) {
+		t.Errorf("tee branch next to panicking one got %v", entries)
+	}
+}
@@ -1,9 +1,258 @@
 package logging
 
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DebugLevel   Level = "DEBUG"
+	InfoLevel    Level = "INFO"
+	WarningLevel Level = "WARNING"
+	ErrorLevel   Level = "ERROR"
+	PanicLevel   Level = "PANIC"
+
+	JsonFormat    Format = "JSON"
+	DebugFormat   Format = "DEBUG"
+	LogfmtFormat  Format = "LOGFMT"
+	ConsoleFormat Format = "CONSOLE"
+	GelfFormat    Format = "GELF"
+)
+
+var levels = map[Level]int{
+	DebugLevel:   0,
+	InfoLevel:    1,
+	WarningLevel: 2,
+	ErrorLevel:   3,
+	PanicLevel:   4,
+}
+
+var formatters = map[Format]func() Formatter{
+	JsonFormat:   NewJsonFormatter,
+	DebugFormat:  NewDebugFormatter,
+	LogfmtFormat: NewLogfmtFormatter,
+	ConsoleFormat: func() Formatter {
+		return NewConsoleFormatter(os.Stdout)
+	},
+	GelfFormat: func() Formatter {
+		host, _ := os.Hostname()
+		return NewGelfFormatter(host)
+	},
+}
+
 type Config struct {
-	Debug    bool
+	Debug bool
+	// LogLevel is one of DEBUG, INFO, WARNING, ERROR or PANIC, empty level means DEBUG
 	LogLevel string
-	EnvName  string
-	Branch   string
-	Commit   string
+	// Format is the default format of printers without own Formatter, it overrides Debug,
+	// when empty DEBUG format is used for Debug config and JSON otherwise
+	Format  Format
+	EnvName string
+	Branch  string
+	Commit  string
+	// Redaction masks sensitive values before entries reach printers, disabled when nil
+	Redaction *RedactionConfig
+	// Sampling limits entries with the same level and message, disabled when nil
+	Sampling *SamplingConfig
+	// Dedup suppresses identical entries within a window, disabled when nil
+	Dedup *DedupConfig
+	// Caller adds caller file:line and function fields of the code calling logger
+	Caller bool
+	// CallerSkip skips additional frames of user logging wrappers when Caller is set
+	CallerSkip int
+	// Stacktrace adds stack field to WARNING and higher entries
+	Stacktrace bool
+	// ReservedFields is policy for reserved fields like status_code with values of unexpected type, RENAME by default
+	ReservedFields ReservedFieldPolicy
+}
+
+// Validate reports the first invalid value in config, NewLogger refuses to start with such config
+func (c Config) Validate() error {
+	_, err := c.normalize()
+	return err
+}
+
+// RegisterFlags binds config fields to command line flags of fs
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(levelFlag{level: &c.LogLevel}, "log-level", "minimal log level: DEBUG, INFO, WARNING, ERROR or PANIC")
+	fs.Var(&c.Format, "log-format", "log format: JSON, DEBUG, LOGFMT, CONSOLE or GELF")
+	fs.BoolVar(&c.Debug, "log-debug", c.Debug, "use human readable DEBUG log format")
+	fs.BoolVar(&c.Caller, "log-caller", c.Caller, "add caller and function fields to every log entry")
+	fs.Var(&c.ReservedFields, "log-reserved-fields", "policy for reserved log fields of unexpected type: RENAME, REJECT or COERCE")
+	fs.BoolVar(&c.Stacktrace, "log-stacktrace", c.Stacktrace, "add stack field to WARNING and higher log entries")
+	fs.StringVar(&c.EnvName, "env-name", c.EnvName, "environment name attached to every log entry")
+	fs.StringVar(&c.Branch, "branch", c.Branch, "branch name attached to every log entry")
+	fs.StringVar(&c.Commit, "commit", c.Commit, "commit hash attached to every log entry")
+}
+
+func (c Config) normalize() (Config, error) {
+	if c.LogLevel == "" {
+		c.LogLevel = string(DebugLevel)
+	}
+
+	level, err := ParseLevel(c.LogLevel)
+	if err != nil {
+		return c, err
+	}
+	c.LogLevel = string(level)
+
+	if c.CallerSkip < 0 {
+		return c, ConfigError.NewF("caller skip must not be negative, got %d", c.CallerSkip)
+	}
+
+	if c.ReservedFields == "" {
+		c.ReservedFields = RenameReservedFields
+	} else if c.ReservedFields, err = ParseReservedFieldPolicy(string(c.ReservedFields)); err != nil {
+		return c, err
+	}
+
+	if c.Sampling != nil {
+		if err = c.Sampling.validate(); err != nil {
+			return c, err
+		}
+	}
+
+	if c.Dedup != nil {
+		if err = c.Dedup.validate(); err != nil {
+			return c, err
+		}
+	}
+
+	if c.Format == "" {
+		if c.Debug {
+			c.Format = DebugFormat
+		} else {
+			c.Format = JsonFormat
+		}
+		return c, nil
+	}
+
+	format, err := ParseFormat(string(c.Format))
+	if err != nil {
+		return c, err
+	}
+	c.Format = format
+
+	return c, nil
+}
+
+// ConfigFromEnv reads config from <prefix>LOG_LEVEL, <prefix>LOG_FORMAT, <prefix>LOG_DEBUG, <prefix>LOG_CALLER,
+// <prefix>LOG_STACKTRACE, <prefix>LOG_RESERVED_FIELDS, <prefix>ENV_NAME, <prefix>BRANCH and <prefix>COMMIT,
+// missing log level defaults to DEBUG like in Config
+func ConfigFromEnv(prefix string) (config Config, err error) {
+	config = Config{
+		LogLevel: os.Getenv(prefix + "LOG_LEVEL"),
+		EnvName:  os.Getenv(prefix + "ENV_NAME"),
+		Branch:   os.Getenv(prefix + "BRANCH"),
+		Commit:   os.Getenv(prefix + "COMMIT"),
+	}
+
+	if value, ok := os.LookupEnv(prefix + "LOG_FORMAT"); ok {
+		config.Format = Format(value)
+	}
+
+	if value, ok := os.LookupEnv(prefix + "LOG_DEBUG"); ok {
+		config.Debug, err = strconv.ParseBool(value)
+		if err != nil {
+			err = ConfigError.NewF("invalid %sLOG_DEBUG value %q, expected boolean", prefix, value)
+			return
+		}
+	}
+
+	if value, ok := os.LookupEnv(prefix + "LOG_CALLER"); ok {
+		config.Caller, err = strconv.ParseBool(value)
+		if err != nil {
+			err = ConfigError.NewF("invalid %sLOG_CALLER value %q, expected boolean", prefix, value)
+			return
+		}
+	}
+
+	if value, ok := os.LookupEnv(prefix + "LOG_STACKTRACE"); ok {
+		config.Stacktrace, err = strconv.ParseBool(value)
+		if err != nil {
+			err = ConfigError.NewF("invalid %sLOG_STACKTRACE value %q, expected boolean", prefix, value)
+			return
+		}
+	}
+
+	if value, ok := os.LookupEnv(prefix + "LOG_RESERVED_FIELDS"); ok {
+		config.ReservedFields = ReservedFieldPolicy(value)
+	}
+
+	config, err = config.normalize()
+	return
+}
+
+type Level string
+
+func ParseLevel(value string) (Level, error) {
+	level := Level(strings.ToUpper(strings.TrimSpace(value)))
+	if level == "WARN" {
+		level = WarningLevel
+	}
+
+	if _, ok := levels[level]; !ok {
+		return "", ConfigError.NewF("unknown log level %q, expected one of DEBUG, INFO, WARNING, ERROR, PANIC", value)
+	}
+
+	return level, nil
+}
+
+// Enabled reports whether entries of level l pass the min threshold
+func (l Level) Enabled(min Level) bool {
+	return levels[l] >= levels[min]
+}
+
+func (l Level) String() string {
+	return string(l)
+}
+
+func (l *Level) Set(value string) (err error) {
+	*l, err = ParseLevel(value)
+	return
+}
+
+// levelFlag binds string LogLevel to flag, value is validated when flag is parsed
+type levelFlag struct {
+	level *string
+}
+
+func (f levelFlag) String() string {
+	if f.level == nil {
+		return ""
+	}
+
+	return *f.level
+}
+
+func (f levelFlag) Set(value string) error {
+	level, err := ParseLevel(value)
+	if err != nil {
+		return err
+	}
+
+	*f.level = string(level)
+	return nil
+}
+
+type Format string
+
+func ParseFormat(value string) (Format, error) {
+	format := Format(strings.ToUpper(strings.TrimSpace(value)))
+	if _, ok := formatters[format]; !ok {
+		return "", ConfigError.NewF("unknown log format %q, expected one of JSON, DEBUG, LOGFMT, CONSOLE, GELF", value)
+	}
+
+	return format, nil
+}
+
+func (f Format) String() string {
+	return string(f)
+}
+
+func (f *Format) Set(value string) (err error) {
+	*f, err = ParseFormat(value)
+	return
 }
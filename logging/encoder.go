@@ -0,0 +1,298 @@
+package logging
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	hexDigits        = "0123456789abcdef"
+	maxPooledBufSize = 64 * 1024
+	smallFieldsCount = 16
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putBuffer returns buffer to pool, large buffers are dropped so single huge entry does not pin memory
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBufSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// ObjectMarshaler is implemented by values encoding own fields without reflection
+type ObjectMarshaler interface {
+	MarshalLogObject(enc *ObjectEncoder)
+}
+
+// ObjectEncoder appends JSON object fields, it is passed to ObjectMarshaler
+type ObjectEncoder struct {
+	buf   []byte
+	empty bool
+}
+
+func (e *ObjectEncoder) AddString(key, value string) {
+	e.key(key)
+	e.buf = appendJsonString(e.buf, value)
+}
+
+func (e *ObjectEncoder) AddInt(key string, value int64) {
+	e.key(key)
+	e.buf = strconv.AppendInt(e.buf, value, 10)
+}
+
+func (e *ObjectEncoder) AddUint(key string, value uint64) {
+	e.key(key)
+	e.buf = strconv.AppendUint(e.buf, value, 10)
+}
+
+func (e *ObjectEncoder) AddFloat(key string, value float64) {
+	e.key(key)
+	e.buf = appendJsonFloat(e.buf, value, 64)
+}
+
+func (e *ObjectEncoder) AddBool(key string, value bool) {
+	e.key(key)
+	e.buf = strconv.AppendBool(e.buf, value)
+}
+
+// AddDuration writes integer nanoseconds like encoding/json
+func (e *ObjectEncoder) AddDuration(key string, value time.Duration) {
+	e.key(key)
+	e.buf = strconv.AppendInt(e.buf, int64(value), 10)
+}
+
+func (e *ObjectEncoder) AddTime(key string, value time.Time) {
+	e.key(key)
+	e.buf = append(e.buf, '"')
+	e.buf = value.AppendFormat(e.buf, time.RFC3339Nano)
+	e.buf = append(e.buf, '"')
+}
+
+func (e *ObjectEncoder) AddObject(key string, value ObjectMarshaler) {
+	e.key(key)
+	e.buf = appendJsonObject(e.buf, value)
+}
+
+// AddAny encodes known types directly and other values with encoding/json
+func (e *ObjectEncoder) AddAny(key string, value interface{}) {
+	e.key(key)
+	e.buf = appendJsonValue(e.buf, value)
+}
+
+func (e *ObjectEncoder) key(key string) {
+	if !e.empty {
+		e.buf = append(e.buf, ',')
+	}
+	e.empty = false
+	e.buf = appendJsonString(e.buf, key)
+	e.buf = append(e.buf, ':')
+}
+
+// appendJsonFields writes fields as JSON object, time, level and message go first and the rest keep their order,
+// the last field wins when names repeat
+func appendJsonFields(buf []byte, fields []LogField) []byte {
+	enc := ObjectEncoder{buf: append(buf, '{'), empty: true}
+
+	var lastBuf [smallFieldsCount]int
+	last := lastFields(fields, lastBuf[:0])
+
+	for _, name := range []string{TimeFieldKey, LogLvlFieldKey, MessageFieldKey} {
+		for _, i := range last {
+			if fields[i].Name == name {
+				enc.AddAny(name, fields[i].Value)
+				break
+			}
+		}
+	}
+
+	for j := len(last) - 1; j >= 0; j-- {
+		field := fields[last[j]]
+		switch field.Name {
+		case TimeFieldKey, LogLvlFieldKey, MessageFieldKey:
+			continue
+		}
+		enc.AddAny(field.Name, field.Value)
+	}
+
+	return append(enc.buf, '}')
+}
+
+// lastFields appends indexes of the last field of every name in reverse order, names of small entries
+// are looked up among kept fields, which is cheaper than building a set
+func lastFields(fields []LogField, last []int) []int {
+	if len(fields) <= smallFieldsCount {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !hasName(fields, last, fields[i].Name) {
+				last = append(last, i)
+			}
+		}
+		return last
+	}
+
+	seen := make(map[string]struct{}, len(fields))
+	for i := len(fields) - 1; i >= 0; i-- {
+		if _, ok := seen[fields[i].Name]; ok {
+			continue
+		}
+		seen[fields[i].Name] = struct{}{}
+		last = append(last, i)
+	}
+
+	return last
+}
+
+func hasName(fields []LogField, indexes []int, name string) bool {
+	for _, i := range indexes {
+		if fields[i].Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func appendJsonObject(buf []byte, value ObjectMarshaler) []byte {
+	enc := ObjectEncoder{buf: append(buf, '{'), empty: true}
+	value.MarshalLogObject(&enc)
+	return append(enc.buf, '}')
+}
+
+func appendJsonValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case string:
+		return appendJsonString(buf, v)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case float32:
+		return appendJsonFloat(buf, float64(v), 32)
+	case float64:
+		return appendJsonFloat(buf, v, 64)
+	case time.Duration:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case time.Time:
+		buf = append(buf, '"')
+		buf = v.AppendFormat(buf, time.RFC3339Nano)
+		return append(buf, '"')
+	case ObjectMarshaler:
+		return appendJsonObject(buf, v)
+	case json.Marshaler:
+		// own JSON encoding is preferred over error text
+	case error:
+		// encoding/json writes errors without exported fields as {}, error text is written instead
+		return appendJsonString(buf, v.Error())
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return appendJsonString(buf, "error during marshaling log field: "+err.Error())
+	}
+
+	return append(buf, data...)
+}
+
+// appendJsonFloat writes NaN and infinities as strings because JSON has no such numbers
+func appendJsonFloat(buf []byte, value float64, bitSize int) []byte {
+	switch {
+	case math.IsNaN(value):
+		return append(buf, `"NaN"`...)
+	case math.IsInf(value, 1):
+		return append(buf, `"+Inf"`...)
+	case math.IsInf(value, -1):
+		return append(buf, `"-Inf"`...)
+	}
+
+	return strconv.AppendFloat(buf, value, 'f', -1, bitSize)
+}
+
+// appendJsonString quotes value like encoding/json without HTML escaping, invalid UTF-8 is replaced with U+FFFD
+func appendJsonString(buf []byte, value string) []byte {
+	buf = append(buf, '"')
+
+	start := 0
+	for i := 0; i < len(value); {
+		if b := value[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+
+			buf = append(buf, value[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(value[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, value[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+
+		// U+2028 and U+2029 are escaped like encoding/json does for javascript consumers
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, value[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+
+	buf = append(buf, value[start:]...)
+	return append(buf, '"')
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type encoderUser struct {
+	id       int64
+	name     string
+	password string
+}
+
+func (u encoderUser) MarshalLogObject(enc *ObjectEncoder) {
+	enc.AddInt("id", u.id)
+	enc.AddString("name", u.name)
+	enc.AddString("password", u.password)
+}
+
+func TestAppendJsonFields(t *testing.T) {
+	got := string(appendJsonFields(nil, []LogField{
+		{Name: "user", Value: "alice"},
+		{Name: MessageFieldKey, Value: "hi"},
+		{Name: "attempt", Value: 1},
+		{Name: LogLvlFieldKey, Value: "INFO"},
+		{Name: "user", Value: "bob"},
+		{Name: TimeFieldKey, Value: "2024-01-02T03:04:05Z"},
+	}))
+
+	expected := `{"time":"2024-01-02T03:04:05Z","level":"INFO","message":"hi","attempt":1,"user":"bob"}`
+	if got != expected {
+		t.Errorf("fields are encoded to %s, expected %s", got, expected)
+	}
+}
+
+func TestAppendJsonValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"<a&b>\n\u2028", `"<a&b>\n\u2028"`},
+		{"\xff", `"\ufffd"`},
+		{1500 * time.Millisecond, `1500000000`},
+		{errors.New("boom"), `"boom"`},
+		{json.RawMessage(`{"a":1}`), `{"a":1}`},
+		{encoderUser{id: 1, name: "bob"}, `{"id":1,"name":"bob","password":""}`},
+		{map[string]int{"b": 2, "a": 1}, `{"a":1,"b":2}`},
+		{nil, `null`},
+	}
+	for _, test := range tests {
+		if got := string(appendJsonValue(nil, test.value)); got != test.expected {
+			t.Errorf("%#v is encoded to %s, expected %s", test.value, got, test.expected)
+		}
+	}
+}
+
+func benchmarkFields() []LogField {
+	return []LogField{
+		{Name: "env_name", Value: "prod"},
+		{Name: RequestIdFieldKey, Value: "5f0c6c2e-8a8b-4c1a-9f5e-1c2d3e4f5a6b"},
+		{Name: StatusCodeFieldKey, Value: 200},
+		{Name: LatencyFieldKey, Value: 1500 * time.Microsecond},
+		{Name: PathLogKey, Value: "/api/v1/orders"},
+		{Name: "user", Value: encoderUser{id: 7, name: "bob"}},
+		{Name: LogLvlFieldKey, Value: "INFO"},
+		{Name: MessageFieldKey, Value: "request handled"},
+		{Name: TimeFieldKey, Value: "2024-01-02T03:04:05.123456Z"},
+	}
+}
+
+func BenchmarkJsonFormatter(b *testing.B) {
+	fields := benchmarkFields()
+	formatter := NewJsonFormatter()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = formatter.Format(fields)
+	}
+}
+
+// BenchmarkJsonMarshalMap encodes entry the way logger did before JSON encoder was added
+func BenchmarkJsonMarshalMap(b *testing.B) {
+	fields := benchmarkFields()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		entry := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			entry[field.Name] = field.Value
+		}
+		data, _ := json.Marshal(entry)
+		_ = string(data)
+	}
+}
+
+func TestAppendJsonFieldsManyRepeated(t *testing.T) {
+	var fields []LogField
+	for i := 0; i < 3*smallFieldsCount; i++ {
+		fields = append(fields, LogField{Name: string(rune('a' + i%20)), Value: i})
+	}
+
+	var decoded map[string]int
+	if err := json.Unmarshal(appendJsonFields(nil, fields), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 20 || decoded["a"] != 40 || decoded["t"] != 39 {
+		t.Errorf("fields are encoded to %v, expected the last values of 20 names", decoded)
+	}
+}
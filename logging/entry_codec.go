@@ -0,0 +1,207 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// types of stored field values, values of other types are kept as encoded JSON and decoded to json.RawMessage
+// which is printed the same way as original value
+const (
+	storedNil      = "nil"
+	storedString   = "string"
+	storedBool     = "bool"
+	storedInt      = "int"
+	storedInt8     = "int8"
+	storedInt16    = "int16"
+	storedInt32    = "int32"
+	storedInt64    = "int64"
+	storedUint     = "uint"
+	storedUint8    = "uint8"
+	storedUint16   = "uint16"
+	storedUint32   = "uint32"
+	storedUint64   = "uint64"
+	storedFloat32  = "float32"
+	storedFloat64  = "float64"
+	storedDuration = "duration"
+	storedTime     = "time"
+	storedError    = "error"
+	storedJson     = "json"
+)
+
+type storedEntry struct {
+	Text   string        `json:"text"`
+	Fields []storedField `json:"fields"`
+}
+
+// storedField keeps value with its type so entries read from disk reach printers with the same types as queued ones
+type storedField struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// textError is error decoded from disk, only its text is stored
+type textError string
+
+func (e textError) Error() string {
+	return string(e)
+}
+
+func encodeEntry(entry Entry) ([]byte, error) {
+	stored := storedEntry{
+		Text:   entry.Text,
+		Fields: make([]storedField, len(entry.Fields)),
+	}
+	for i, field := range entry.Fields {
+		stored.Fields[i] = encodeField(field)
+	}
+
+	return json.Marshal(stored)
+}
+
+func encodeField(field LogField) storedField {
+	typ, text := storedNil, ""
+	switch v := field.Value.(type) {
+	case nil:
+	case string:
+		typ, text = storedString, v
+	case bool:
+		typ, text = storedBool, strconv.FormatBool(v)
+	case int:
+		typ, text = storedInt, strconv.FormatInt(int64(v), 10)
+	case int8:
+		typ, text = storedInt8, strconv.FormatInt(int64(v), 10)
+	case int16:
+		typ, text = storedInt16, strconv.FormatInt(int64(v), 10)
+	case int32:
+		typ, text = storedInt32, strconv.FormatInt(int64(v), 10)
+	case int64:
+		typ, text = storedInt64, strconv.FormatInt(v, 10)
+	case uint:
+		typ, text = storedUint, strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		typ, text = storedUint8, strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		typ, text = storedUint16, strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		typ, text = storedUint32, strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		typ, text = storedUint64, strconv.FormatUint(v, 10)
+	case float32:
+		typ, text = storedFloat32, strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		typ, text = storedFloat64, strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Duration:
+		typ, text = storedDuration, strconv.FormatInt(int64(v), 10)
+	case time.Time:
+		typ, text = storedTime, v.Format(time.RFC3339Nano)
+	case json.Marshaler, ObjectMarshaler:
+		return storedField{Name: field.Name, Type: storedJson, Value: appendJsonValue(nil, v)}
+	case error:
+		typ, text = storedError, v.Error()
+	default:
+		return storedField{Name: field.Name, Type: storedJson, Value: appendJsonValue(nil, v)}
+	}
+
+	return storedField{Name: field.Name, Type: typ, Value: appendJsonString(nil, text)}
+}
+
+func decodeEntry(data []byte) (entry Entry, err error) {
+	var stored storedEntry
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return
+	}
+
+	entry.Text = stored.Text
+	entry.Fields = make([]LogField, len(stored.Fields))
+	for i, field := range stored.Fields {
+		if entry.Fields[i], err = decodeField(field); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// decodeField restores field value, fields without type are written by older versions as plain JSON
+func decodeField(field storedField) (result LogField, err error) {
+	result.Name = field.Name
+	switch field.Type {
+	case "", storedJson:
+		if len(field.Value) > 0 {
+			result.Value = field.Value
+		}
+		return
+	case storedNil:
+		return
+	}
+
+	var text string
+	if err = json.Unmarshal(field.Value, &text); err != nil {
+		return
+	}
+
+	switch field.Type {
+	case storedString:
+		result.Value = text
+	case storedError:
+		result.Value = textError(text)
+	case storedBool:
+		result.Value, err = strconv.ParseBool(text)
+	case storedInt, storedInt8, storedInt16, storedInt32, storedInt64, storedDuration:
+		var value int64
+		value, err = strconv.ParseInt(text, 10, 64)
+		result.Value = intValue(field.Type, value)
+	case storedUint, storedUint8, storedUint16, storedUint32, storedUint64:
+		var value uint64
+		value, err = strconv.ParseUint(text, 10, 64)
+		result.Value = uintValue(field.Type, value)
+	case storedFloat32:
+		var value float64
+		value, err = strconv.ParseFloat(text, 32)
+		result.Value = float32(value)
+	case storedFloat64:
+		result.Value, err = strconv.ParseFloat(text, 64)
+	case storedTime:
+		result.Value, err = time.Parse(time.RFC3339Nano, text)
+	default:
+		err = fmt.Errorf("unknown stored type %q of field %q", field.Type, field.Name)
+	}
+
+	return
+}
+
+func intValue(typ string, value int64) interface{} {
+	switch typ {
+	case storedInt:
+		return int(value)
+	case storedInt8:
+		return int8(value)
+	case storedInt16:
+		return int16(value)
+	case storedInt32:
+		return int32(value)
+	case storedDuration:
+		return time.Duration(value)
+	default:
+		return value
+	}
+}
+
+func uintValue(typ string, value uint64) interface{} {
+	switch typ {
+	case storedUint:
+		return uint(value)
+	case storedUint8:
+		return uint8(value)
+	case storedUint16:
+		return uint16(value)
+	case storedUint32:
+		return uint32(value)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,10 @@
+package logging
+
+import "golibs/errors"
+
+var (
+	ConfigError = errors.NewWrapper("invalid logger config", errors.ValidationErrorType)
+	FlushError  = errors.NewWrapper("log entries are not flushed")
+	FileError   = errors.NewWrapper("log file error")
+	FieldError  = errors.NewWrapper("invalid log field", errors.ValidationErrorType)
+)
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"sort"
+	"time"
+)
+
+// String, Int and other constructors build fields for Logger.With, typed values are encoded without reflection
+
+func String(name, value string) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+func Int(name string, value int) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+func Int64(name string, value int64) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+func Uint64(name string, value uint64) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+func Float64(name string, value float64) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+func Bool(name string, value bool) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+// Duration is written to JSON as integer nanoseconds like encoding/json does and as "1.5s" to text formats
+func Duration(name string, value time.Duration) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+// Time is written in RFC3339 format with nanoseconds
+func Time(name string, value time.Time) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+// Err returns error field with error text, nil error gives empty text
+func Err(err error) LogField {
+	if err == nil {
+		return LogField{Name: ErrorFieldKey, Value: ""}
+	}
+
+	return LogField{Name: ErrorFieldKey, Value: err.Error()}
+}
+
+// Any returns field of any type, values of unknown types are encoded with encoding/json
+func Any(name string, value interface{}) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+// Object returns field encoded by value itself as nested JSON object
+func Object(name string, value ObjectMarshaler) LogField {
+	return LogField{Name: name, Value: value}
+}
+
+// RequestId, StatusCode and other setters build reserved fields with values of expected types
+
+func RequestId(id string) LogField {
+	return LogField{Name: RequestIdFieldKey, Value: id}
+}
+
+func StatusCode(code int) LogField {
+	return LogField{Name: StatusCodeFieldKey, Value: code}
+}
+
+func Latency(latency time.Duration) LogField {
+	return LogField{Name: LatencyFieldKey, Value: latency}
+}
+
+func Method(method string) LogField {
+	return LogField{Name: MethodFieldKey, Value: method}
+}
+
+func Path(path string) LogField {
+	return LogField{Name: PathLogKey, Value: path}
+}
+
+func RemoteAddress(address string) LogField {
+	return LogField{Name: RemoteAddressFieldKey, Value: address}
+}
+
+func RequestUserUid(uid string) LogField {
+	return LogField{Name: RequestUserUidKey, Value: uid}
+}
+
+// with returns logger copy with fields added in order after reserved field policy,
+// existing fields with the same name are replaced in place
+func (l logger) with(fields []LogField) *logger {
+	merged := make([]LogField, len(l.fields), len(l.fields)+len(fields))
+	copy(merged, l.fields)
+
+	index := make(map[string]int, cap(merged))
+	for i, field := range merged {
+		index[field.Name] = i
+	}
+
+	for _, field := range fields {
+		field, ok := l.reservedFields.apply(field)
+		if !ok {
+			continue
+		}
+		if i, ok := index[field.Name]; ok {
+			merged[i].Value = field.Value
+			continue
+		}
+		index[field.Name] = len(merged)
+		merged = append(merged, field)
+	}
+
+	// full slice expression keeps appends in write from sharing backing array between goroutines
+	l.fields = merged[:len(merged):len(merged)]
+	return &l
+}
+
+// sortedFields converts map to fields ordered by name so output does not depend on map iteration order
+func sortedFields(fields map[string]interface{}) []LogField {
+	result := make([]LogField, 0, len(fields))
+	for name, value := range fields {
+		result = append(result, LogField{Name: name, Value: value})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
@@ -0,0 +1,447 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	fileQueueCapacity    = 1000
+	defaultBufferSize    = 64 * 1024
+	defaultFlushInterval = time.Second
+	backupTimeFormat     = "2006-01-02T15-04-05.000"
+	compressSuffix       = ".gz"
+)
+
+type FilePrinterConfig struct {
+	Path string
+	// Formatter renders entries instead of logger format when set
+	Formatter Formatter
+	// MaxSize rotates file before it exceeds the size in bytes, zero disables size rotation
+	MaxSize int64
+	// RotateEvery rotates file at interval boundaries in UTC, e.g. 24h rotates at midnight, zero disables time rotation
+	RotateEvery time.Duration
+	// Compress gzips rotated files
+	Compress bool
+	// MaxBackups removes the oldest rotated files above the count, zero keeps every file
+	MaxBackups int
+	// MaxAge removes rotated files older than the duration, zero keeps every file
+	MaxAge time.Duration
+	// BufferSize defaults to 64KB
+	BufferSize int
+	// FlushInterval writes buffered entries to file periodically, defaults to 1s
+	FlushInterval time.Duration
+	// ReopenOnSIGHUP reopens file on SIGHUP for external rotation tools like logrotate
+	ReopenOnSIGHUP bool
+	// Queue defaults to 1000 entries blocking the caller when full
+	Queue QueueConfig
+}
+
+func (c FilePrinterConfig) validate() error {
+	if c.Path == "" {
+		return ConfigError.New("log file path is required")
+	}
+	if c.MaxSize < 0 || c.RotateEvery < 0 || c.MaxBackups < 0 || c.MaxAge < 0 {
+		return ConfigError.New("log file rotation limits must not be negative")
+	}
+
+	return nil
+}
+
+type filePrinter struct {
+	conf      FilePrinterConfig
+	queue     *Queue
+	formatter Formatter
+
+	mu       sync.Mutex
+	file     *os.File
+	buffer   *bufio.Writer
+	size     int64
+	rotateAt time.Time
+
+	mill    sync.Mutex
+	milling sync.WaitGroup
+	signals chan os.Signal
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewFilePrinter appends entries to file rotating it by size and time, rotated files are named
+// <name>-<time><ext> next to the log file, <name>-<time>.<seq><ext> when several rotations happen within a millisecond
+func NewFilePrinter(conf FilePrinterConfig) (Printer, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = defaultBufferSize
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+
+	printer := &filePrinter{
+		conf:      conf,
+		formatter: conf.Formatter,
+		stop:      make(chan struct{}),
+	}
+
+	if err := printer.open(); err != nil {
+		return nil, err
+	}
+
+	queue, err := NewQueue(conf.Queue.WithDefaults(fileQueueCapacity, OverflowBlock), func(_ context.Context, entry Entry) {
+		printer.write(entry.Text)
+	})
+	if err != nil {
+		_ = printer.file.Close()
+		return nil, err
+	}
+	printer.queue = queue
+
+	if conf.ReopenOnSIGHUP {
+		printer.signals = make(chan os.Signal, 1)
+		signal.Notify(printer.signals, syscall.SIGHUP)
+	}
+
+	printer.stopped.Add(1)
+	go printer.background()
+
+	return printer, nil
+}
+
+func (f *filePrinter) Print(msg string, fields []LogField) {
+	if f.formatter != nil {
+		msg = f.formatter.Format(fields)
+	}
+
+	f.queue.Push(Entry{Text: msg})
+}
+
+// Flush waits for queued entries and writes buffered ones to file
+func (f *filePrinter) Flush(ctx context.Context) error {
+	if err := f.queue.Flush(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.buffer.Flush(); err != nil {
+		return FileError.Wrap(err)
+	}
+
+	return nil
+}
+
+// Close stops accepting entries, waits up to DefaultDrainTimeout for queued ones, flushes buffer and closes file
+func (f *filePrinter) Close() error {
+	err := f.queue.Close()
+
+	if f.signals != nil {
+		signal.Stop(f.signals)
+	}
+	close(f.stop)
+	f.stopped.Wait()
+
+	f.mu.Lock()
+	if closeErr := f.closeFile(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	f.mu.Unlock()
+
+	f.milling.Wait()
+
+	return err
+}
+
+func (f *filePrinter) Stats() QueueStats {
+	return f.queue.Stats()
+}
+
+func (f *filePrinter) background() {
+	defer f.stopped.Done()
+
+	ticker := time.NewTicker(f.conf.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			if err := f.buffer.Flush(); err != nil {
+				printQueueError(err, "error during flushing log file buffer")
+			}
+			f.mu.Unlock()
+		case <-f.signals:
+			f.mu.Lock()
+			err := f.closeFile()
+			if err == nil {
+				err = f.open()
+			}
+			f.mu.Unlock()
+			if err != nil {
+				printQueueError(err, "error during reopening log file")
+			}
+		}
+	}
+}
+
+func (f *filePrinter) write(text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line := int64(len(text) + 1)
+	if f.shouldRotate(line) {
+		if err := f.rotate(); err != nil {
+			printQueueError(err, "error during rotating log file")
+		}
+	}
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			printQueueError(err, "error during opening log file")
+			return
+		}
+	}
+
+	if _, err := f.buffer.WriteString(text + "\n"); err != nil {
+		printQueueError(err, "error during writing log file")
+		return
+	}
+	f.size += line
+}
+
+func (f *filePrinter) shouldRotate(line int64) bool {
+	if f.file == nil {
+		return false
+	}
+	if f.conf.MaxSize > 0 && f.size > 0 && f.size+line > f.conf.MaxSize {
+		return true
+	}
+
+	return !f.rotateAt.IsZero() && !time.Now().Before(f.rotateAt)
+}
+
+func (f *filePrinter) open() error {
+	if dir := filepath.Dir(f.conf.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return FileError.Wrap(err)
+		}
+	}
+
+	file, err := os.OpenFile(f.conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return FileError.Wrap(err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return FileError.Wrap(err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	if f.buffer == nil {
+		f.buffer = bufio.NewWriterSize(file, f.conf.BufferSize)
+	} else {
+		f.buffer.Reset(file)
+	}
+	if f.conf.RotateEvery > 0 {
+		f.rotateAt = time.Now().UTC().Truncate(f.conf.RotateEvery).Add(f.conf.RotateEvery)
+	}
+
+	return nil
+}
+
+func (f *filePrinter) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.buffer.Flush()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	f.file = nil
+	if err != nil {
+		return FileError.Wrap(err)
+	}
+
+	return nil
+}
+
+// rotate renames current file to backup name, compression and retention run in background
+func (f *filePrinter) rotate() error {
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+
+	backup := f.backupName(time.Now().UTC())
+	if err := os.Rename(f.conf.Path, backup); err != nil {
+		return FileError.Wrap(err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.milling.Add(1)
+	go f.millBackups(backup)
+
+	return nil
+}
+
+// backupName adds sequence number to backups rotated within the same millisecond instead of overwriting them
+func (f *filePrinter) backupName(ts time.Time) string {
+	dir, name := filepath.Split(f.conf.Path)
+	ext := filepath.Ext(name)
+	base := filepath.Join(dir, strings.TrimSuffix(name, ext)+"-"+ts.Format(backupTimeFormat))
+
+	for seq := 0; ; seq++ {
+		path := base + ext
+		if seq > 0 {
+			path = base + "." + strconv.Itoa(seq) + ext
+		}
+		if !fileExists(path) && !fileExists(path+compressSuffix) {
+			return path
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+func (f *filePrinter) millBackups(backup string) {
+	defer f.milling.Done()
+
+	f.mill.Lock()
+	defer f.mill.Unlock()
+
+	if f.conf.Compress {
+		if err := compressFile(backup); err != nil {
+			printQueueError(err, "error during compressing rotated log file")
+		}
+	}
+
+	if f.conf.MaxBackups == 0 && f.conf.MaxAge == 0 {
+		return
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		printQueueError(err, "error during listing rotated log files")
+		return
+	}
+
+	cutoff := time.Now().Add(-f.conf.MaxAge)
+	for i, backup := range backups {
+		expired := f.conf.MaxAge > 0 && backup.ts.Before(cutoff)
+		if expired || (f.conf.MaxBackups > 0 && i >= f.conf.MaxBackups) {
+			if err = os.Remove(backup.path); err != nil && !os.IsNotExist(err) {
+				printQueueError(err, "error during removing rotated log file")
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	path string
+	ts   time.Time
+	seq  int
+}
+
+// backups returns rotated files sorted from the newest one
+func (f *filePrinter) backups() ([]backupFile, error) {
+	dir, name := filepath.Split(f.conf.Path)
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+
+	if dir == "" {
+		dir = "."
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, FileError.Wrap(err)
+	}
+
+	var result []backupFile
+	for _, file := range files {
+		fileName := strings.TrimSuffix(file.Name(), compressSuffix)
+		if file.IsDir() || !strings.HasPrefix(fileName, prefix) || !strings.HasSuffix(fileName, ext) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(fileName, prefix), ext)
+		var seq int
+		if len(stamp) > len(backupTimeFormat) && stamp[len(backupTimeFormat)] == '.' {
+			if seq, err = strconv.Atoi(stamp[len(backupTimeFormat)+1:]); err != nil {
+				continue
+			}
+			stamp = stamp[:len(backupTimeFormat)]
+		}
+
+		ts, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		result = append(result, backupFile{path: filepath.Join(dir, file.Name()), ts: ts, seq: seq})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ts.Equal(result[j].ts) {
+			return result[i].seq > result[j].seq
+		}
+		return result[i].ts.After(result[j].ts)
+	})
+
+	return result, nil
+}
+
+func compressFile(path string) (err error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return FileError.Wrap(err)
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(path+compressSuffix, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return FileError.Wrap(err)
+	}
+
+	writer := gzip.NewWriter(target)
+	_, err = io.Copy(writer, source)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path + compressSuffix)
+		return FileError.Wrap(err)
+	}
+
+	if err = os.Remove(path); err != nil {
+		return FileError.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package logging
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestFilePrinter(t *testing.T, conf FilePrinterConfig) (*filePrinter, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "file_printer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	if conf.Path == "" {
+		conf.Path = filepath.Join(dir, "app.log")
+	} else {
+		conf.Path = filepath.Join(dir, conf.Path)
+	}
+	printer, err := NewFilePrinter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return printer.(*filePrinter), dir
+}
+
+func printLines(t *testing.T, printer *filePrinter, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		printer.Print(line, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := printer.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLogFiles returns lines of every file in dir by file name, gzipped files are decompressed
+func readLogFiles(t *testing.T, dir string) map[string][]string {
+	t.Helper()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string][]string{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(file.Name(), compressSuffix) {
+			reader, err := gzip.NewReader(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = ioutil.ReadAll(reader); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result[file.Name()] = strings.Fields(string(data))
+	}
+
+	return result
+}
+
+func allLines(files map[string][]string) []string {
+	var lines []string
+	for _, fileLines := range files {
+		lines = append(lines, fileLines...)
+	}
+	sort.Strings(lines)
+
+	return lines
+}
+
+func TestFilePrinterRotatesBySize(t *testing.T) {
+	// every line takes 6 bytes, so two of them do not fit into 10 bytes file
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{MaxSize: 10})
+	printLines(t, printer, "line1", "line2", "line3", "line4", "line5")
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readLogFiles(t, dir)
+	if len(files) != 5 {
+		t.Fatalf("files %v, expected current file and 4 backups", files)
+	}
+	if lines := files["app.log"]; len(lines) != 1 || lines[0] != "line5" {
+		t.Errorf("current file has %v, expected the last line", lines)
+	}
+	// rotations within the same millisecond must not overwrite each other
+	if lines := allLines(files); strings.Join(lines, " ") != "line1 line2 line3 line4 line5" {
+		t.Errorf("files keep lines %v, expected every printed line once", lines)
+	}
+	for name := range files {
+		if name != "app.log" && !(strings.HasPrefix(name, "app-") && strings.HasSuffix(name, ".log")) {
+			t.Errorf("unexpected backup name %s", name)
+		}
+	}
+}
+
+func TestFilePrinterRotatesByTime(t *testing.T) {
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{RotateEvery: 50 * time.Millisecond})
+	printLines(t, printer, "before")
+	time.Sleep(60 * time.Millisecond)
+	printLines(t, printer, "after")
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readLogFiles(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("files %v, expected current file and 1 backup", files)
+	}
+	if lines := files["app.log"]; len(lines) != 1 || lines[0] != "after" {
+		t.Errorf("current file has %v, expected line printed after rotation time", lines)
+	}
+}
+
+func TestFilePrinterKeepsMaxBackups(t *testing.T) {
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{MaxSize: 10, MaxBackups: 2})
+	printLines(t, printer, "line1", "line2", "line3", "line4", "line5")
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readLogFiles(t, dir)
+	if lines := allLines(files); strings.Join(lines, " ") != "line3 line4 line5" {
+		t.Errorf("files keep lines %v, expected current file and 2 newest backups", lines)
+	}
+}
+
+func TestFilePrinterRemovesExpiredBackups(t *testing.T) {
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{MaxSize: 10, MaxAge: time.Hour})
+	expired := filepath.Join(dir, "app-2000-01-01T00-00-00.000.log")
+	if err := ioutil.WriteFile(expired, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	printLines(t, printer, "line1", "line2")
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("backup older than MaxAge is kept: %v", err)
+	}
+	if lines := allLines(readLogFiles(t, dir)); strings.Join(lines, " ") != "line1 line2" {
+		t.Errorf("files keep lines %v, expected fresh backup and current file", lines)
+	}
+}
+
+func TestFilePrinterCompressesBackups(t *testing.T) {
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{MaxSize: 10, Compress: true})
+	printLines(t, printer, "line1", "line2", "line3")
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readLogFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("files %v, expected current file and 2 compressed backups", files)
+	}
+	for name := range files {
+		if name != "app.log" && !strings.HasSuffix(name, ".log"+compressSuffix) {
+			t.Errorf("backup %s is not compressed", name)
+		}
+	}
+	if lines := allLines(files); strings.Join(lines, " ") != "line1 line2 line3" {
+		t.Errorf("files keep lines %v, expected every printed line once", lines)
+	}
+}
+
+func TestFilePrinterBackupNameSequence(t *testing.T) {
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{})
+	defer printer.Close()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	first := printer.backupName(ts)
+	if err := ioutil.WriteFile(first+compressSuffix, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := printer.backupName(ts)
+	if err := ioutil.WriteFile(second, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	third := printer.backupName(ts)
+
+	expected := []string{"app-2024-01-02T03-04-05.006.log", "app-2024-01-02T03-04-05.006.1.log", "app-2024-01-02T03-04-05.006.2.log"}
+	for i, name := range []string{first, second, third} {
+		if name != filepath.Join(dir, expected[i]) {
+			t.Errorf("backup name %d is %s, expected %s", i, filepath.Base(name), expected[i])
+		}
+	}
+
+	if err := ioutil.WriteFile(third, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := printer.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 || backups[0].path != third || backups[2].path != first+compressSuffix {
+		t.Errorf("backups %+v, expected the highest sequence first", backups)
+	}
+}
+
+func TestFilePrinterReopensOnSIGHUP(t *testing.T) {
+	printer, dir := newTestFilePrinter(t, FilePrinterConfig{ReopenOnSIGHUP: true})
+	defer printer.Close()
+
+	printLines(t, printer, "before")
+	// external tool moves the file and asks printer to reopen it
+	moved := filepath.Join(dir, "app.log.1")
+	if err := os.Rename(printer.conf.Path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !fileExists(printer.conf.Path) {
+		if time.Now().After(deadline) {
+			t.Fatal("log file is not reopened after SIGHUP")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	printLines(t, printer, "after")
+	files := readLogFiles(t, dir)
+	if lines := files["app.log.1"]; len(lines) != 1 || lines[0] != "before" {
+		t.Errorf("moved file has %v, expected line printed before SIGHUP", lines)
+	}
+	if lines := files["app.log"]; len(lines) != 1 || lines[0] != "after" {
+		t.Errorf("reopened file has %v, expected line printed after SIGHUP", lines)
+	}
+}
@@ -0,0 +1,331 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var levelColors = map[Level]string{
+	DebugLevel:   "\033[4;3m",
+	InfoLevel:    "\033[0;34m",
+	WarningLevel: "\033[0;33m",
+	ErrorLevel:   "\033[0;31m",
+	PanicLevel:   "\033[41m",
+}
+
+var syslogSeverities = map[Level]int{
+	DebugLevel:   7,
+	InfoLevel:    6,
+	WarningLevel: 4,
+	ErrorLevel:   3,
+	PanicLevel:   2,
+}
+
+// Formatter renders log entry fields into a single log line
+type Formatter interface {
+	Format(fields []LogField) string
+}
+
+func NewJsonFormatter() Formatter {
+	return jsonFormatter{}
+}
+
+func NewDebugFormatter() Formatter {
+	return debugFormatter{}
+}
+
+func NewLogfmtFormatter() Formatter {
+	return logfmtFormatter{}
+}
+
+// NewConsoleFormatter returns aligned human friendly formatter, colors are enabled when out is a terminal
+func NewConsoleFormatter(out *os.File) Formatter {
+	return consoleFormatter{colors: isTerminal(out)}
+}
+
+func NewColoredConsoleFormatter(colors bool) Formatter {
+	return consoleFormatter{colors: colors}
+}
+
+// NewGelfFormatter returns GELF 1.1 formatter, host is used as GELF source host
+func NewGelfFormatter(host string) Formatter {
+	return gelfFormatter{host: host}
+}
+
+// SyslogSeverity maps log level to syslog severity used by GELF and syslog outputs
+func SyslogSeverity(level Level) int {
+	if severity, ok := syslogSeverities[level]; ok {
+		return severity
+	}
+
+	return syslogSeverities[InfoLevel]
+}
+
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(fields []LogField) string {
+	buf := getBuffer()
+	*buf = appendJsonFields(*buf, fields)
+	jsonLog := string(*buf)
+	putBuffer(buf)
+
+	return jsonLog
+}
+
+type debugFormatter struct{}
+
+func (debugFormatter) Format(fields []LogField) string {
+	level := Level(FieldString(fields, LogLvlFieldKey))
+	lvl := level.String()
+	if color, ok := levelColors[level]; ok {
+		lvl = color + lvl + "\033[m"
+		if level == PanicLevel {
+			lvl = color + level.String() + "\033[40m\033[m"
+		}
+	}
+
+	return fmt.Sprintf("%s	%s	%s	%s", EntryTime(fields).Format(time.RFC3339), lvl, FieldString(fields, MessageFieldKey),
+		jsonFormatter{}.Format(fields))
+}
+
+type logfmtFormatter struct{}
+
+func (logfmtFormatter) Format(fields []LogField) string {
+	var buf bytes.Buffer
+	for _, field := range orderedFields(fields) {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(field.Name))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(FormatValue(field.Value)))
+	}
+
+	return buf.String()
+}
+
+type consoleFormatter struct {
+	colors bool
+}
+
+func (c consoleFormatter) Format(fields []LogField) string {
+	level := Level(FieldString(fields, LogLvlFieldKey))
+	lvl := fmt.Sprintf("%-7s", level.String())
+	if color, ok := levelColors[level]; ok && c.colors {
+		lvl = color + lvl + "\033[m"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(EntryTime(fields).Format("2006-01-02 15:04:05.000"))
+	buf.WriteByte(' ')
+	buf.WriteString(lvl)
+	buf.WriteByte(' ')
+	buf.WriteString(fmt.Sprintf("%-40s", FieldString(fields, MessageFieldKey)))
+
+	for _, field := range fields {
+		switch field.Name {
+		case LogLvlFieldKey, MessageFieldKey, TimeFieldKey:
+			continue
+		}
+
+		buf.WriteByte(' ')
+		if c.colors {
+			buf.WriteString("\033[2m" + logfmtKey(field.Name) + "=\033[m")
+		} else {
+			buf.WriteString(logfmtKey(field.Name) + "=")
+		}
+		buf.WriteString(logfmtValue(FormatValue(field.Value)))
+	}
+
+	return strings.TrimRight(buf.String(), " ")
+}
+
+type gelfFormatter struct {
+	host string
+}
+
+func (g gelfFormatter) Format(fields []LogField) string {
+	jsonLog, err := json.Marshal(GelfMessage(g.host, fields))
+	if err != nil {
+		return fmt.Sprintf(`{"version":"1.1","host":%q,"short_message":"error during marshaling log fields","_error":%q}`,
+			g.host, err.Error())
+	}
+
+	return string(jsonLog)
+}
+
+// GelfMessage maps log fields to GELF 1.1 message, level is converted to syslog severity,
+// timestamp is taken from time field and other fields are sent as additional fields
+func GelfMessage(host string, fields []LogField) map[string]interface{} {
+	message := FieldString(fields, MessageFieldKey)
+	if message == "" {
+		message = "empty message"
+	}
+
+	ts := EntryTime(fields)
+	entry := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": message,
+		"timestamp":     math.Round(float64(ts.UnixNano())/1e6) / 1e3,
+		"level":         SyslogSeverity(Level(FieldString(fields, LogLvlFieldKey))),
+	}
+
+	for _, field := range fields {
+		switch field.Name {
+		case LogLvlFieldKey, MessageFieldKey, TimeFieldKey:
+			continue
+		}
+
+		name := GelfFieldName(field.Name)
+		if _, ok := entry[name]; ok {
+			continue
+		}
+
+		// GELF additional fields are strings or numbers only
+		switch value := field.Value.(type) {
+		case bool:
+			entry[name] = strconv.FormatBool(value)
+		case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			entry[name] = value
+		default:
+			entry[name] = FormatValue(value)
+		}
+	}
+
+	return entry
+}
+
+// GelfFieldName converts field name to GELF additional field name, "_id" is reserved by graylog
+func GelfFieldName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-') {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if sanitized == "id" {
+		sanitized = "field_id"
+	}
+
+	return "_" + sanitized
+}
+
+func isTerminal(out *os.File) bool {
+	if out == nil || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := out.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func orderedFields(fields []LogField) []LogField {
+	result := make([]LogField, 0, len(fields))
+	for _, name := range []string{TimeFieldKey, LogLvlFieldKey, MessageFieldKey} {
+		for _, field := range fields {
+			if field.Name == name {
+				result = append(result, field)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		switch field.Name {
+		case LogLvlFieldKey, MessageFieldKey, TimeFieldKey:
+			continue
+		}
+		result = append(result, field)
+	}
+
+	return result
+}
+
+// FieldValue returns value of the last field with name
+func FieldValue(fields []LogField, name string) (value interface{}, ok bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Name == name {
+			return fields[i].Value, true
+		}
+	}
+
+	return
+}
+
+// FieldString returns the last value of field with name printed by FormatValue
+func FieldString(fields []LogField, name string) string {
+	value, ok := FieldValue(fields, name)
+	if !ok {
+		return ""
+	}
+
+	return FormatValue(value)
+}
+
+// EntryTime parses time field added by logger, current time is returned when it is missing
+func EntryTime(fields []LogField) time.Time {
+	value, _ := FieldValue(fields, TimeFieldKey)
+	if str, ok := value.(string); ok {
+		if ts, err := time.Parse(time.RFC3339Nano, str); err == nil {
+			return ts
+		}
+	}
+
+	return time.Now().UTC()
+}
+
+// FormatValue prints value as text, values without text form are encoded as JSON
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case []byte:
+		return string(v)
+	case ObjectMarshaler:
+		return string(appendJsonObject(nil, v))
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
+
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGelfMessageFieldTypes(t *testing.T) {
+	entry := GelfMessage("host", []LogField{
+		{Name: MessageFieldKey, Value: "hello"},
+		{Name: LogLvlFieldKey, Value: string(ErrorLevel)},
+		{Name: "cached", Value: true},
+		{Name: "retried", Value: false},
+		{Name: "count", Value: 3},
+		{Name: "ratio", Value: 0.5},
+		{Name: "user", Value: "alice"},
+		{Name: "took", Value: 2 * time.Second},
+		{Name: "tags", Value: []string{"a", "b"}},
+	})
+
+	for name, expected := range map[string]interface{}{
+		"short_message": "hello",
+		"level":         SyslogSeverity(ErrorLevel),
+		"_cached":       "true",
+		"_retried":      "false",
+		"_count":        3,
+		"_ratio":        0.5,
+		"_user":         "alice",
+		"_took":         "2s",
+		"_tags":         `["a","b"]`,
+	} {
+		if value := entry[name]; value != expected {
+			t.Errorf("GELF field %s is %#v, expected %#v", name, value, expected)
+		}
+	}
+
+	for name, value := range entry {
+		switch value.(type) {
+		case string, int, int64, float64:
+		default:
+			t.Errorf("GELF field %s has %T value, only strings and numbers are allowed", name, value)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultDrainTimeout bounds the time Close of built-in printers waits for queued entries
+const DefaultDrainTimeout = 5 * time.Second
+
+// Flusher is implemented by printers writing entries asynchronously,
+// Flush returns when every entry queued before the call is written or ctx is done
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// PendingEntries counts entries queued by asynchronous printer and lets Flush wait for them
+type PendingEntries struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+func (p *PendingEntries) Add() {
+	p.mu.Lock()
+	if p.count == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.count++
+	p.mu.Unlock()
+}
+
+func (p *PendingEntries) Done() {
+	p.mu.Lock()
+	p.count--
+	if p.count == 0 {
+		close(p.idle)
+	}
+	p.mu.Unlock()
+}
+
+func (p *PendingEntries) Count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.count
+}
+
+func (p *PendingEntries) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	if p.count == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return FlushError.Wrap(ctx.Err())
+	}
+}
+
+// Flush waits until printer has written queued entries, printers without Flush method are written synchronously
+func Flush(ctx context.Context, printer Printer) error {
+	if flusher, ok := printer.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+
+	return nil
+}
+
+// Close closes printer if it implements io.Closer
+func Close(printer Printer) error {
+	if closer, ok := printer.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
@@ -1,21 +1,14 @@
 package logging
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"golibs/errors"
 )
 
 const (
-	debugLogLevel   = "DEBUG"
-	warningLogLevel = "WARNING"
-	infoLogLevel    = "INFO"
-	errorLogLevel   = "ERROR"
-	panicLogLevel   = "PANIC"
-
 	LogLvlFieldKey        = "level"
 	MessageFieldKey       = "message"
 	TimeFieldKey          = "time"
@@ -30,63 +23,52 @@ const (
 	ResponseErrorFieldKey = "response_error"
 	RemoteAddressFieldKey = "remote_address"
 	RequestUserUidKey     = "request_user_uid"
-
-	jsonLogFormat  = "JSON"
-	debugLogFormat = "DEBUG"
+	CallerFieldKey        = "caller"
+	FunctionFieldKey      = "function"
+	StackFieldKey         = "stack"
 )
 
-var defaultLogFields = map[string]bool{
-	LogLvlFieldKey:        true,
-	MessageFieldKey:       true,
-	TimeFieldKey:          true,
-	ErrorFieldKey:         true,
-	RequestIdFieldKey:     true,
-	PathLogKey:            true,
-	StatusCodeFieldKey:    true,
-	LatencyFieldKey:       true,
-	MethodFieldKey:        true,
-	RequestFieldKey:       true,
-	ResponseFieldKey:      true,
-	ResponseErrorFieldKey: true,
-	RemoteAddressFieldKey: true,
-	RequestUserUidKey:     true,
-}
-
-var levels = map[string]int{
-	debugLogLevel:   0,
-	infoLogLevel:    1,
-	warningLogLevel: 2,
-	errorLogLevel:   3,
-	panicLogLevel:   4,
-}
-
 func NewLogger(config Config, printers []Printer) (logger Logger, err error) {
-
-	var format string
-	if config.Debug {
-		format = debugLogFormat
-	} else {
-		format = jsonLogFormat
+	config, err = config.normalize()
+	if err != nil {
+		return
 	}
 
-	logger = buildLogger(printers, format, strings.ToUpper(config.LogLevel)).
-		WithFields(map[string]interface{}{
-			"env_name": config.EnvName,
-			"branch":   config.Branch,
-			"commit":   config.Commit,
-		})
+	l := buildLogger(printers, formatters[config.Format](), Level(config.LogLevel))
+	if config.Redaction != nil {
+		l.redactor = NewRedactor(*config.Redaction)
+	}
+	if config.Sampling != nil {
+		l.sampler = newSampler(*config.Sampling)
+	}
+	if config.Dedup != nil {
+		l.dedup = newDeduplicator(*config.Dedup)
+	}
+	l.caller = config.Caller
+	l.callerSkip = config.CallerSkip
+	l.stacktrace = config.Stacktrace
+	l.reservedFields = config.ReservedFields
+
+	root := l.with(sortedFields(map[string]interface{}{
+		"env_name": config.EnvName,
+		"branch":   config.Branch,
+		"commit":   config.Commit,
+	}))
+	if root.dedup != nil {
+		root.dedup.root = root
+	}
 
+	logger = root
 	return
 }
 
 func NewTestLogger(printers ...Printer) Logger {
-	return &logger{
-		printers:   printers,
-		fields:     nil,
-		level:      errorLogLevel,
-		format:     debugLogFormat,
-		errorHooks: nil,
-	}
+	return NewTestLoggerWithLevel(ErrorLevel, printers...)
+}
+
+// NewTestLoggerWithLevel returns logger without env fields printing entries of level and above in debug format
+func NewTestLoggerWithLevel(level Level, printers ...Printer) Logger {
+	return buildLogger(printers, NewDebugFormatter(), level)
 }
 
 type Logger interface {
@@ -106,22 +88,39 @@ type Logger interface {
 	Replicate() Logger
 	WithField(name string, value interface{}) Logger
 	WithFields(map[string]interface{}) Logger
+	With(fields ...LogField) Logger
+	Stats() Stats
+	// Sync writes pending dedup summaries and flushes every printer, it is safe to call on shutdown
+	Sync(ctx context.Context) error
 }
 
-func buildLogger(printers []Printer, format, level string) *logger {
-	return &logger{
-		printers: printers,
-		level:    level,
-		format:   format,
+func buildLogger(printers []Printer, formatter Formatter, level Level) *logger {
+	l := &logger{
+		level:          level,
+		formatter:      formatter,
+		reservedFields: RenameReservedFields,
 	}
+	for _, printer := range printers {
+		l.AddPrinter(printer)
+	}
+
+	return l
 }
 
 type logger struct {
 	printers   []Printer
 	fields     []LogField
-	level      string
-	format     string
-	errorHooks []errorHook
+	level      Level
+	formatter  Formatter
+	redactor   *Redactor
+	sampler    *sampler
+	dedup      *deduplicator
+	caller     bool
+	callerSkip int
+	stacktrace bool
+	// reservedFields is applied to every field added with With, WithField and WithFields
+	reservedFields ReservedFieldPolicy
+	errorHooks     []errorHook
 }
 
 type LogField struct {
@@ -138,54 +137,26 @@ func (l *logger) RegErrorHook(action errorHook) {
 }
 
 func (l logger) WithField(name string, value interface{}) Logger {
-	fieldsCopy := make([]LogField, len(l.fields))
-	copy(fieldsCopy, l.fields)
-	l.fields = fieldsCopy
-
-	name = l.getCorrectFieldName(name, value)
-	for i := range l.fields {
-		if l.fields[i].Name == name {
-			l.fields[i].Value = value
-			return &l
-		}
-	}
-	l.fields = append(l.fields, LogField{Name: name, Value: value})
-	return &l
+	return l.with([]LogField{{Name: name, Value: value}})
 }
 
+// WithFields adds fields in name order
 func (l logger) WithFields(fields map[string]interface{}) Logger {
-	fieldsCopy := make([]LogField, len(l.fields))
-	copy(fieldsCopy, l.fields)
-	l.fields = fieldsCopy
-	for name, value := range fields {
-		found := false
-		for i := range l.fields {
-			if l.fields[i].Name == name {
-				l.fields[i].Value = value
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			l.fields = append(l.fields, LogField{Name: name, Value: value})
-		}
-	}
+	return l.with(sortedFields(fields))
+}
 
-	return &l
+// With adds fields built by String, Int, Object and other constructors keeping their order
+func (l logger) With(fields ...LogField) Logger {
+	return l.with(fields)
 }
 
 func (l *logger) AddPrinter(printer Printer) {
+	bindFormatter(printer, l.formatter)
 	l.printers = append(l.printers, printer)
 }
 
 func (l *logger) Debug(msg string) {
-	if levels[l.level] > levels[debugLogLevel] {
-		return
-	}
-
-	log, fields := l.createLog(debugLogLevel, msg, l.fields)
-	l.print(log, fields)
+	l.write(DebugLevel, msg, l.fields)
 }
 
 func (l *logger) DebugF(format string, args ...interface{}) {
@@ -193,12 +164,7 @@ func (l *logger) DebugF(format string, args ...interface{}) {
 }
 
 func (l *logger) Info(msg string) {
-	if levels[l.level] > levels[infoLogLevel] {
-		return
-	}
-
-	log, fields := l.createLog(infoLogLevel, msg, l.fields)
-	l.print(log, fields)
+	l.write(InfoLevel, msg, l.fields)
 }
 
 func (l *logger) InfoF(format string, args ...interface{}) {
@@ -206,12 +172,7 @@ func (l *logger) InfoF(format string, args ...interface{}) {
 }
 
 func (l *logger) Warn(msg string) {
-	if levels[l.level] > levels[warningLogLevel] {
-		return
-	}
-
-	log, fields := l.createLog(warningLogLevel, msg, l.fields)
-	l.print(log, fields)
+	l.write(WarningLevel, msg, l.fields)
 }
 
 func (l *logger) WarnF(format string, args ...interface{}) {
@@ -219,11 +180,7 @@ func (l *logger) WarnF(format string, args ...interface{}) {
 }
 
 func (l *logger) Error(err error) {
-	if levels[l.level] > levels[errorLogLevel] {
-		return
-	}
-
-	log, fields := l.createLog(errorLogLevel, "Error occurred!",
+	written := l.write(ErrorLevel, "Error occurred!",
 		append(
 			l.fields,
 			LogField{
@@ -233,19 +190,14 @@ func (l *logger) Error(err error) {
 		),
 	)
 
-	l.print(log, fields)
-	if !errors.IsType(err, errors.DoesNotExistErrorType, errors.AlreadyExistErrorType, errors.InconsistentErrorType,
+	if written && !errors.IsType(err, errors.DoesNotExistErrorType, errors.AlreadyExistErrorType, errors.InconsistentErrorType,
 		errors.ValidationErrorType, errors.ForbiddenErrorType) {
 		l.triggerErrorHooks("Error occurred!", err.Error())
 	}
 }
 
 func (l *logger) ErrorF(err error, format string, args ...interface{}) {
-	if levels[l.level] > levels[errorLogLevel] {
-		return
-	}
-
-	log, fields := l.createLog(errorLogLevel, fmt.Sprintf(format, args...),
+	written := l.write(ErrorLevel, fmt.Sprintf(format, args...),
 		append(
 			l.fields,
 			LogField{
@@ -255,39 +207,83 @@ func (l *logger) ErrorF(err error, format string, args ...interface{}) {
 		),
 	)
 
-	l.print(log, fields)
-	if !errors.IsType(err, errors.DoesNotExistErrorType, errors.AlreadyExistErrorType, errors.InconsistentErrorType,
+	if written && !errors.IsType(err, errors.DoesNotExistErrorType, errors.AlreadyExistErrorType, errors.InconsistentErrorType,
 		errors.ValidationErrorType, errors.ForbiddenErrorType) {
 		l.triggerErrorHooks("Error occurred: "+fmt.Sprintf(format, args...), err.Error())
 	}
 }
 
 func (l *logger) Panic(msg string) {
-	if levels[l.level] > levels[panicLogLevel] {
-		return
+	if l.write(PanicLevel, msg, l.fields) {
+		l.triggerErrorHooks("panic: "+msg, "")
 	}
-
-	log, fields := l.createLog(panicLogLevel, msg, l.fields)
-
-	l.print(log, fields)
-	l.triggerErrorHooks("panic: "+msg, "")
 }
 
 func (l *logger) PanicF(format string, args ...interface{}) {
 	l.Panic(fmt.Sprintf(format, args...))
 }
 
+func (l *logger) Stats() (stats Stats) {
+	if l.sampler != nil {
+		stats.Sampled = l.sampler.droppedCount()
+	}
+	if l.dedup != nil {
+		stats.Deduplicated = l.dedup.suppressedCount()
+	}
+
+	return
+}
+
+func (l *logger) Sync(ctx context.Context) (err error) {
+	if l.dedup != nil {
+		l.dedup.flush()
+	}
+
+	for _, printer := range l.printers {
+		if flushErr := Flush(ctx, printer); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+
+	return
+}
+
+// write prints entry unless it is filtered by level, sampling or deduplication
+func (l *logger) write(level Level, message string, fields []LogField) bool {
+	if !level.Enabled(l.level) {
+		return false
+	}
+
+	if l.sampler != nil || l.dedup != nil {
+		key := entryKey(level, message, fields)
+		if l.sampler != nil && !l.sampler.allow(key) {
+			return false
+		}
+		if l.dedup != nil && !l.dedup.allow(key, level, message, fields) {
+			return false
+		}
+	}
+
+	withStack := l.stacktrace && level.Enabled(WarningLevel)
+	if l.caller || withStack {
+		fields = append(fields[:len(fields):len(fields)], callerFields(l.callerSkip, l.caller, withStack)...)
+	}
+
+	l.print(l.createLog(level, message, fields))
+	return true
+}
+
 func (l *logger) print(msg string, fields []LogField) {
 	for _, printer := range l.printers {
 		printer.Print(msg, fields)
 	}
 }
 
-func (l *logger) createLog(level, message string, fields []LogField) (fullString string, fullFields []LogField) {
+func (l *logger) createLog(level Level, message string, fields []LogField) (fullString string, fullFields []LogField) {
 	fields = append(fields,
 		LogField{
 			Name:  LogLvlFieldKey,
-			Value: level,
+			Value: level.String(),
 		}, LogField{
 			Name:  MessageFieldKey,
 			Value: message,
@@ -296,53 +292,17 @@ func (l *logger) createLog(level, message string, fields []LogField) (fullString
 			Value: time.Now().UTC().Format(time.RFC3339Nano),
 		})
 
-	switch l.format {
-	case jsonLogFormat:
-		return l.fieldsToJsonFormat(fields), fields
-	case debugLogFormat:
-		lvl := level
-		switch level {
-		case debugLogLevel:
-			lvl = "\033[4;3m" + level + "\033[m"
-		case infoLogLevel:
-			lvl = "\033[0;34m" + level + "\033[m"
-		case warningLogLevel:
-			lvl = "\033[0;33m" + level + "\033[m"
-		case errorLogLevel:
-			lvl = "\033[0;31m" + level + "\033[m"
-		case panicLogLevel:
-			lvl = "\033[41m" + level + "\033[40m\033[m"
-		}
-
-		return l.fieldsToDebugFormat(fields, lvl, message), fields
-	default:
-		panic("wrong logs format!")
-	}
-}
-
-func (l *logger) fieldsToJsonFormat(fields []LogField) string {
-	entry := make(map[string]interface{}, len(fields))
-	for _, field := range fields {
-		entry[field.Name] = field.Value
-	}
-
-	jsonLog, err := json.Marshal(entry)
-	if err != nil {
-
+	if l.redactor != nil {
+		fields = l.redactor.Redact(fields)
 	}
-	return string(jsonLog)
-}
 
-func (l *logger) fieldsToDebugFormat(fields []LogField, level, message string) string {
-	return fmt.Sprintf("%s	%s	%s	%s", time.Now().UTC().Format(time.RFC3339), level, message, l.fieldsToJsonFormat(fields))
+	return l.formatter.Format(fields), fields
 }
 
 func (l *logger) triggerErrorHooks(msg, err string) {
 	var requestId string
-	for _, field := range l.fields {
-		if field.Name == RequestIdFieldKey {
-			requestId = field.Value.(string)
-		}
+	if value, ok := FieldValue(l.fields, RequestIdFieldKey); ok {
+		requestId = FormatValue(value)
 	}
 
 	for _, hook := range l.errorHooks {
@@ -350,16 +310,4 @@ func (l *logger) triggerErrorHooks(msg, err string) {
 	}
 }
 
-func (l *logger) getCorrectFieldName(key string, value interface{}) string {
-	if !defaultLogFields[key] {
-		return key
-	}
-
-	if _, ok := value.(string); ok {
-		return key
-	}
-
-	return "custom_" + key
-}
-
 type errorHook func(msg, err, requestId string)
@@ -0,0 +1,68 @@
+package logtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// HookCall is single error hook invocation
+type HookCall struct {
+	Message   string
+	Error     string
+	RequestId string
+}
+
+// Hooks captures error hook invocations, register Hook with logging.Logger.RegErrorHook
+type Hooks struct {
+	mu    sync.Mutex
+	calls []HookCall
+}
+
+func NewHooks() *Hooks {
+	return &Hooks{}
+}
+
+func (h *Hooks) Hook(msg, err, requestId string) {
+	h.mu.Lock()
+	h.calls = append(h.calls, HookCall{Message: msg, Error: err, RequestId: requestId})
+	h.mu.Unlock()
+}
+
+// Calls returns copy of captured invocations in call order
+func (h *Hooks) Calls() []HookCall {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]HookCall(nil), h.calls...)
+}
+
+func (h *Hooks) Reset() {
+	h.mu.Lock()
+	h.calls = nil
+	h.mu.Unlock()
+}
+
+// AssertCalled fails test when no invocation has error containing errSubstr, the first matching call is returned
+func (h *Hooks) AssertCalled(t testing.TB, errSubstr string) HookCall {
+	t.Helper()
+
+	calls := h.Calls()
+	for _, call := range calls {
+		if strings.Contains(call.Error, errSubstr) {
+			return call
+		}
+	}
+
+	t.Errorf("error hook is not called with error containing %q, captured calls: %v", errSubstr, calls)
+	return HookCall{}
+}
+
+// AssertNotCalled fails test when error hooks were invoked
+func (h *Hooks) AssertNotCalled(t testing.TB) {
+	t.Helper()
+
+	if calls := h.Calls(); len(calls) > 0 {
+		t.Errorf("error hook is called %d times, first call: %+v", len(calls), calls[0])
+	}
+}
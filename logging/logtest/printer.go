@@ -0,0 +1,49 @@
+package logtest
+
+import (
+	"sync"
+	"testing"
+
+	"golibs/logging"
+)
+
+// tbPrinter routes entries to t.Log, entries printed after the test has finished are ignored
+type tbPrinter struct {
+	mu        sync.Mutex
+	t         testing.TB
+	formatter logging.Formatter
+	finished  bool
+}
+
+// NewTBPrinter returns printer writing entries to test log, so they are shown only for failed or verbose tests,
+// entries are formatted by console formatter without colors whatever logger formatter is
+func NewTBPrinter(t testing.TB) logging.Printer {
+	printer := &tbPrinter{t: t, formatter: logging.NewColoredConsoleFormatter(false)}
+	t.Cleanup(func() {
+		printer.mu.Lock()
+		printer.finished = true
+		printer.mu.Unlock()
+	})
+
+	return printer
+}
+
+func (p *tbPrinter) Print(_ string, fields []logging.LogField) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.finished {
+		p.t.Log(p.formatter.Format(fields))
+	}
+}
+
+// NewLogger returns logger printing entries of level and above to recorder and test log, error hooks are captured
+func NewLogger(t testing.TB, level logging.Level) (logging.Logger, *Recorder, *Hooks) {
+	recorder := NewRecorder()
+	hooks := NewHooks()
+
+	logger := logging.NewTestLoggerWithLevel(level, recorder, NewTBPrinter(t))
+	logger.RegErrorHook(hooks.Hook)
+
+	return logger, recorder, hooks
+}
@@ -0,0 +1,67 @@
+package logtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golibs/logging"
+)
+
+// fakeTB captures test log, methods not used by printer panic through nil embedded interface
+type fakeTB struct {
+	testing.TB
+	logs     []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Log(args ...interface{}) {
+	for _, arg := range args {
+		f.logs = append(f.logs, arg.(string))
+	}
+}
+
+func (f *fakeTB) Cleanup(cleanup func()) {
+	f.cleanups = append(f.cleanups, cleanup)
+}
+
+func (f *fakeTB) Helper() {}
+
+func TestTBPrinterWritesPlainText(t *testing.T) {
+	tb := &fakeTB{}
+	logger := logging.NewTestLoggerWithLevel(logging.DebugLevel, NewTBPrinter(tb))
+
+	logger.With(logging.String("user", "bob")).Error(errors.New("boom"))
+	if len(tb.logs) != 1 {
+		t.Fatalf("%d lines are logged, expected 1", len(tb.logs))
+	}
+	if line := tb.logs[0]; strings.Contains(line, "\x1b[") || !strings.Contains(line, "boom") || !strings.Contains(line, "bob") {
+		t.Errorf("logged line %q is not plain text with error and fields", line)
+	}
+
+	for _, cleanup := range tb.cleanups {
+		cleanup()
+	}
+	logger.Info("after test")
+	if len(tb.logs) != 1 {
+		t.Errorf("entry printed after test has finished is logged")
+	}
+}
+
+func TestNewLoggerCapturesEntriesAndHooks(t *testing.T) {
+	logger, recorder, hooks := NewLogger(t, logging.InfoLevel)
+
+	logger.Debug("hidden")
+	logger.WithField(logging.RequestIdFieldKey, "req-1").ErrorF(errors.New("db is down"), "query failed")
+
+	recorder.AssertNotLogged(t, "", "hidden", nil)
+	entry := recorder.AssertLogged(t, logging.ErrorLevel, "query failed", map[string]interface{}{logging.RequestIdFieldKey: "req-1"})
+	if entry.Text == "" {
+		t.Error("recorded entry has no formatted text")
+	}
+
+	call := hooks.AssertCalled(t, "db is down")
+	if call.RequestId != "req-1" {
+		t.Errorf("hook is called with request id %q", call.RequestId)
+	}
+}
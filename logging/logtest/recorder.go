@@ -0,0 +1,160 @@
+// Package logtest provides printers and assertions for testing code which writes logs
+package logtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golibs/logging"
+)
+
+// Entry is single recorded log entry
+type Entry struct {
+	Level   logging.Level
+	Message string
+	// Text is entry rendered by logger formatter
+	Text   string
+	Fields []logging.LogField
+}
+
+// Field returns the last value of field with name
+func (e Entry) Field(name string) (value interface{}, ok bool) {
+	for i := len(e.Fields) - 1; i >= 0; i-- {
+		if e.Fields[i].Name == name {
+			return e.Fields[i].Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Matches reports whether entry has level, message containing msgSubstr and every field from fields,
+// empty level matches any level
+func (e Entry) Matches(level logging.Level, msgSubstr string, fields map[string]interface{}) bool {
+	if level != "" && e.Level != level {
+		return false
+	}
+	if !strings.Contains(e.Message, msgSubstr) {
+		return false
+	}
+
+	for name, expected := range fields {
+		value, ok := e.Field(name)
+		if !ok || !equalValues(expected, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Recorder is printer keeping every entry in memory, it is safe for concurrent use
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Print(text string, fields []logging.LogField) {
+	entry := Entry{
+		Text:   text,
+		Fields: append([]logging.LogField(nil), fields...),
+	}
+	if level, ok := entry.Field(logging.LogLvlFieldKey); ok {
+		entry.Level = logging.Level(fmt.Sprint(level))
+	}
+	if message, ok := entry.Field(logging.MessageFieldKey); ok {
+		entry.Message = fmt.Sprint(message)
+	}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+}
+
+// Entries returns copy of recorded entries in print order
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Entry(nil), r.entries...)
+}
+
+// Find returns entries matching level, message substring and fields, see Entry.Matches
+func (r *Recorder) Find(level logging.Level, msgSubstr string, fields map[string]interface{}) []Entry {
+	var result []Entry
+	for _, entry := range r.Entries() {
+		if entry.Matches(level, msgSubstr, fields) {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// AssertLogged fails test when no entry matches level, message substring and fields, the first matching entry is returned
+func (r *Recorder) AssertLogged(t testing.TB, level logging.Level, msgSubstr string, fields map[string]interface{}) Entry {
+	t.Helper()
+
+	found := r.Find(level, msgSubstr, fields)
+	if len(found) == 0 {
+		t.Errorf("no %s entry with message containing %q and fields %v, recorded entries:\n%s",
+			levelName(level), msgSubstr, fields, r.dump())
+		return Entry{}
+	}
+
+	return found[0]
+}
+
+// AssertNotLogged fails test when any entry matches level, message substring and fields
+func (r *Recorder) AssertNotLogged(t testing.TB, level logging.Level, msgSubstr string, fields map[string]interface{}) {
+	t.Helper()
+
+	if found := r.Find(level, msgSubstr, fields); len(found) > 0 {
+		t.Errorf("unexpected %s entry with message containing %q and fields %v:\n%s",
+			levelName(level), msgSubstr, fields, found[0].Text)
+	}
+}
+
+func (r *Recorder) dump() string {
+	entries := r.Entries()
+	if len(entries) == 0 {
+		return "  <none>"
+	}
+
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = "  " + entry.Text
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func levelName(level logging.Level) string {
+	if level == "" {
+		return "log"
+	}
+
+	return string(level)
+}
+
+// equalValues compares deeply and falls back to printed values so 5 matches int64(5) or "5"
+func equalValues(expected, actual interface{}) bool {
+	if reflect.DeepEqual(expected, actual) {
+		return true
+	}
+
+	return fmt.Sprint(expected) == fmt.Sprint(actual)
+}
@@ -0,0 +1,63 @@
+package logtest
+
+import (
+	"testing"
+
+	"golibs/logging"
+)
+
+func TestEntryMatches(t *testing.T) {
+	entry := Entry{
+		Level:   logging.InfoLevel,
+		Message: "user logged in",
+		Fields:  []logging.LogField{{Name: "user_id", Value: int64(5)}, {Name: "user_id", Value: int64(7)}},
+	}
+
+	tests := []struct {
+		name     string
+		level    logging.Level
+		message  string
+		fields   map[string]interface{}
+		expected bool
+	}{
+		{"any level", "", "logged", nil, true},
+		{"other level", logging.ErrorLevel, "logged", nil, false},
+		{"other message", logging.InfoLevel, "logged out", nil, false},
+		{"last field value", logging.InfoLevel, "", map[string]interface{}{"user_id": 7}, true},
+		{"overridden field value", logging.InfoLevel, "", map[string]interface{}{"user_id": 5}, false},
+		{"missing field", logging.InfoLevel, "", map[string]interface{}{"role": "admin"}, false},
+	}
+	for _, test := range tests {
+		if got := entry.Matches(test.level, test.message, test.fields); got != test.expected {
+			t.Errorf("%s: matches is %v, expected %v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestRecorderReset(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.Print("text", []logging.LogField{
+		{Name: logging.LogLvlFieldKey, Value: "WARNING"},
+		{Name: logging.MessageFieldKey, Value: "disk is full"},
+	})
+
+	if entries := recorder.Find(logging.WarningLevel, "disk", nil); len(entries) != 1 || entries[0].Text != "text" {
+		t.Errorf("found entries %v, expected recorded one", entries)
+	}
+
+	recorder.Reset()
+	if entries := recorder.Entries(); len(entries) != 0 {
+		t.Errorf("%d entries are left after reset", len(entries))
+	}
+}
+
+func TestHooksReset(t *testing.T) {
+	hooks := NewHooks()
+	hooks.Hook("msg", "err", "req")
+	if calls := hooks.Calls(); len(calls) != 1 || calls[0] != (HookCall{Message: "msg", Error: "err", RequestId: "req"}) {
+		t.Errorf("captured calls are %v", calls)
+	}
+
+	hooks.Reset()
+	hooks.AssertNotCalled(t)
+}
@@ -1,29 +1,70 @@
 package logging
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
+
+const consoleQueueCapacity = 100
 
 type Printer interface {
 	Print(entry string, fields []LogField)
 }
 
+type ConsolePrinterConfig struct {
+	// Formatter renders entries instead of logger format when set
+	Formatter Formatter
+	// Queue defaults to 100 entries blocking the caller when full
+	Queue QueueConfig
+}
+
 type consolePrinter struct {
-	messageQueue chan string
+	queue     *Queue
+	formatter Formatter
+}
+
+// NewConsolePrinterWithFormatter returns console printer rendering entries with own formatter instead of logger format
+func NewConsolePrinterWithFormatter(formatter Formatter) Printer {
+	printer, _ := NewConsolePrinterWithConfig(ConsolePrinterConfig{Formatter: formatter})
+	return printer
 }
 
 func NewConsolePrinter() Printer {
-	channel := make(chan string, 100)
+	printer, _ := NewConsolePrinterWithConfig(ConsolePrinterConfig{})
+	return printer
+}
 
-	go func(ch chan string) {
-		defer fmt.Println("printer has stopped!!!")
+func NewConsolePrinterWithConfig(conf ConsolePrinterConfig) (Printer, error) {
+	queue, err := NewQueue(conf.Queue.WithDefaults(consoleQueueCapacity, OverflowBlock), func(_ context.Context, entry Entry) {
+		fmt.Println(entry.Text)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		for msg := range channel {
-			fmt.Println(msg)
-		}
-	}(channel)
+	return &consolePrinter{
+		queue:     queue,
+		formatter: conf.Formatter,
+	}, nil
+}
+
+func (c *consolePrinter) Print(msg string, fields []LogField) {
+	if c.formatter != nil {
+		msg = c.formatter.Format(fields)
+	}
+
+	c.queue.Push(Entry{Text: msg})
+}
+
+func (c *consolePrinter) Flush(ctx context.Context) error {
+	return c.queue.Flush(ctx)
+}
 
-	return &consolePrinter{messageQueue: channel}
+// Close stops accepting entries and waits up to DefaultDrainTimeout for queued ones
+func (c *consolePrinter) Close() error {
+	return c.queue.Close()
 }
 
-func (c *consolePrinter) Print(msg string, _ []LogField) {
-	c.messageQueue <- msg
+func (c *consolePrinter) Stats() QueueStats {
+	return c.queue.Stats()
 }
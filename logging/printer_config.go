@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type PrinterConfig struct {
+	// MinLevel drops entries below the level, empty value passes every entry
+	MinLevel Level
+	// AllowFields keeps only listed fields, level, message and time fields are always kept
+	AllowFields []string
+	DenyFields  []string
+	// SampleEvery passes one of every SampleEvery entries, 0 and 1 pass every entry
+	SampleEvery uint64
+	// Formatter renders entries with dropped fields, logger format is used when nil
+	Formatter Formatter
+}
+
+// NewConfiguredPrinter wraps printer with its own level threshold, field filter and sampling
+func NewConfiguredPrinter(printer Printer, conf PrinterConfig) (Printer, error) {
+	result := &configuredPrinter{
+		printer:     printer,
+		sampleEvery: conf.SampleEvery,
+		formatter:   conf.Formatter,
+	}
+
+	if conf.MinLevel != "" {
+		level, err := ParseLevel(string(conf.MinLevel))
+		if err != nil {
+			return nil, err
+		}
+		result.minLevel = level
+	}
+
+	if len(conf.AllowFields) > 0 {
+		result.allow = map[string]bool{
+			LogLvlFieldKey:  true,
+			MessageFieldKey: true,
+			TimeFieldKey:    true,
+		}
+		for _, name := range conf.AllowFields {
+			result.allow[name] = true
+		}
+	}
+
+	if len(conf.DenyFields) > 0 {
+		result.deny = make(map[string]bool, len(conf.DenyFields))
+		for _, name := range conf.DenyFields {
+			result.deny[name] = true
+		}
+	}
+
+	return result, nil
+}
+
+type configuredPrinter struct {
+	printer     Printer
+	minLevel    Level
+	allow       map[string]bool
+	deny        map[string]bool
+	sampleEvery uint64
+	counter     uint64
+	formatter   Formatter
+}
+
+func (c *configuredPrinter) Print(entry string, fields []LogField) {
+	if c.minLevel != "" && !Level(FieldString(fields, LogLvlFieldKey)).Enabled(c.minLevel) {
+		return
+	}
+
+	if c.sampleEvery > 1 && (atomic.AddUint64(&c.counter, 1)-1)%c.sampleEvery != 0 {
+		return
+	}
+
+	if c.allow == nil && c.deny == nil {
+		c.printer.Print(entry, fields)
+		return
+	}
+
+	filtered := make([]LogField, 0, len(fields))
+	for _, field := range fields {
+		if (c.allow != nil && !c.allow[field.Name]) || c.deny[field.Name] {
+			continue
+		}
+		filtered = append(filtered, field)
+	}
+
+	if len(filtered) != len(fields) {
+		formatter := c.formatter
+		if formatter == nil {
+			formatter = NewJsonFormatter()
+		}
+		entry = formatter.Format(filtered)
+	}
+
+	c.printer.Print(entry, filtered)
+}
+
+// bindFormatter sets logger format as the printer formatter unless it was configured explicitly
+func (c *configuredPrinter) bindFormatter(formatter Formatter) {
+	if c.formatter == nil {
+		c.formatter = formatter
+	}
+}
+
+func (c *configuredPrinter) Flush(ctx context.Context) error {
+	return Flush(ctx, c.printer)
+}
+
+func (c *configuredPrinter) Close() error {
+	return Close(c.printer)
+}
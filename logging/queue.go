@@ -0,0 +1,548 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golibs/logging/wal"
+)
+
+const (
+	OverflowBlock      OverflowPolicy = "BLOCK"
+	OverflowDropNewest OverflowPolicy = "DROP_NEWEST"
+	OverflowDropOldest OverflowPolicy = "DROP_OLDEST"
+	OverflowSpill      OverflowPolicy = "SPILL"
+
+	DefaultQueueCapacity = 1000
+)
+
+type OverflowPolicy string
+
+type QueueConfig struct {
+	// Capacity is the number of entries kept in memory, printer default is used when zero
+	Capacity int
+	// Overflow defines what happens to entries pushed into full queue, printer default is used when empty
+	Overflow OverflowPolicy
+	// SpillPath is the file storing overflowed entries for SPILL policy, it is truncated on start
+	SpillPath string
+	// SpillMaxBytes limits spill file size, entries are dropped when it is reached, zero means no limit
+	SpillMaxBytes int64
+	// Persistent writes every entry to disk segments before handling instead of memory queue,
+	// entries which are not handled before Close are replayed on the next start, Capacity and Overflow are ignored except SPILL which is rejected
+	Persistent *wal.Config
+}
+
+// Entry is the printer input queued for asynchronous writing
+type Entry struct {
+	Text   string
+	Fields []LogField
+}
+
+type QueueStats struct {
+	Queued  int
+	Spilled uint64
+	Dropped uint64
+	// Evicted counts persistent entries removed because of disk limit
+	Evicted uint64
+}
+
+type BatchConfig struct {
+	// MaxEntries limits entries passed to batch handler at once
+	MaxEntries int
+	// MaxWait is the time batch handler waits for MaxEntries entries before handling smaller batch
+	MaxWait time.Duration
+}
+
+// QueueHandler writes single entry, ctx is canceled when queue is closed
+type QueueHandler func(ctx context.Context, entry Entry)
+
+// BatchHandler writes entries in push order, ctx is canceled when queue is closed
+type BatchHandler func(ctx context.Context, entries []Entry)
+
+// WithDefaults fills empty batch limits with printer defaults
+func (c BatchConfig) WithDefaults(maxEntries int, maxWait time.Duration) BatchConfig {
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = maxEntries
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = maxWait
+	}
+
+	return c
+}
+
+// WithDefaults fills empty capacity and overflow policy with printer defaults
+func (c QueueConfig) WithDefaults(capacity int, overflow OverflowPolicy) QueueConfig {
+	if c.Capacity <= 0 {
+		c.Capacity = capacity
+	}
+	if c.Overflow == "" {
+		c.Overflow = overflow
+	}
+
+	return c
+}
+
+func (c QueueConfig) validate() error {
+	// persistent queue keeps every entry on disk, so there is no memory capacity to overflow
+	if c.Persistent != nil {
+		if c.Overflow == OverflowSpill {
+			return ConfigError.New("SPILL overflow policy can not be used with persistent queue")
+		}
+		return nil
+	}
+
+	if c.Capacity <= 0 {
+		return ConfigError.NewF("queue capacity must be positive, got %d", c.Capacity)
+	}
+
+	switch c.Overflow {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+	case OverflowSpill:
+		if c.SpillPath == "" {
+			return ConfigError.New("spill path is required for SPILL overflow policy")
+		}
+	default:
+		return ConfigError.NewF("unknown queue overflow policy %q, expected one of BLOCK, DROP_NEWEST, DROP_OLDEST, SPILL", string(c.Overflow))
+	}
+
+	return nil
+}
+
+// NewQueue starts single consumer goroutine passing queued entries to handler in push order
+func NewQueue(conf QueueConfig, handler QueueHandler) (*Queue, error) {
+	return NewBatchQueue(conf, BatchConfig{MaxEntries: 1}, func(ctx context.Context, entries []Entry) {
+		for _, entry := range entries {
+			handler(ctx, entry)
+		}
+	})
+}
+
+// NewBatchQueue starts single consumer goroutine passing queued entries to handler in batches
+func NewBatchQueue(conf QueueConfig, batch BatchConfig, handler BatchHandler) (*Queue, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	if batch.MaxEntries <= 0 {
+		return nil, ConfigError.NewF("batch max entries must be positive, got %d", batch.MaxEntries)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		conf:    conf,
+		batch:   batch,
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	if conf.Persistent == nil {
+		q.items = make([]Entry, 0, conf.Capacity)
+	}
+
+	if conf.Overflow == OverflowSpill {
+		spill, err := openSpillFile(conf.SpillPath, conf.SpillMaxBytes)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		q.spill = spill
+	}
+
+	if conf.Persistent != nil {
+		log, err := wal.Open(*conf.Persistent)
+		if err != nil {
+			cancel()
+			return nil, ConfigError.Wrap(err)
+		}
+		q.wal = log
+		for i := log.Len(); i > 0; i-- {
+			q.pending.Add()
+		}
+	}
+
+	go q.consume()
+
+	return q, nil
+}
+
+type Queue struct {
+	conf       QueueConfig
+	batch      BatchConfig
+	handler    BatchHandler
+	mu         sync.Mutex
+	notEmpty   *sync.Cond
+	notFull    *sync.Cond
+	items      []Entry
+	spill      *spillFile
+	wal        *wal.Log
+	walEvicted uint64
+	// appending counts persist calls writing to wal outside of mu, Close waits for them
+	appending sync.WaitGroup
+	closed    bool
+	pending   PendingEntries
+	spilled   uint64
+	dropped   uint64
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopped   chan struct{}
+}
+
+// Push queues entry applying overflow policy when queue is full, entries pushed after Close are dropped
+func (q *Queue) Push(entry Entry) {
+	if q.wal != nil {
+		q.persist(entry)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for !q.closed && q.conf.Overflow == OverflowBlock && len(q.items) >= q.conf.Capacity {
+		q.notFull.Wait()
+	}
+
+	if q.closed {
+		atomic.AddUint64(&q.dropped, 1)
+		return
+	}
+
+	// once spilling started new entries follow spilled ones to keep the order
+	if len(q.items) >= q.conf.Capacity || (q.spill != nil && q.spill.count > 0) {
+		switch q.conf.Overflow {
+		case OverflowDropNewest:
+			atomic.AddUint64(&q.dropped, 1)
+			return
+		case OverflowDropOldest:
+			q.items = q.items[1:]
+			atomic.AddUint64(&q.dropped, 1)
+			q.pending.Done()
+		case OverflowSpill:
+			if err := q.spill.write(entry); err != nil {
+				atomic.AddUint64(&q.dropped, 1)
+				printQueueError(err, "error during spilling log entry to disk")
+				return
+			}
+			atomic.AddUint64(&q.spilled, 1)
+			q.pending.Add()
+			q.notEmpty.Signal()
+			return
+		}
+	}
+
+	q.items = append(q.items, entry)
+	q.pending.Add()
+	q.notEmpty.Signal()
+}
+
+func (q *Queue) Flush(ctx context.Context) error {
+	return q.pending.Wait(ctx)
+}
+
+// Close stops accepting entries, waits up to DefaultDrainTimeout for queued ones and stops consumer
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.notFull.Broadcast()
+	q.notEmpty.Broadcast()
+	q.mu.Unlock()
+	q.appending.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	defer cancel()
+	err := q.Flush(ctx)
+
+	q.cancel()
+	q.mu.Lock()
+	q.notEmpty.Broadcast()
+	q.mu.Unlock()
+	<-q.stopped
+
+	if q.spill != nil {
+		if closeErr := q.spill.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	if q.wal != nil {
+		if closeErr := q.wal.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	queued := len(q.items)
+	if q.spill != nil {
+		queued += q.spill.count
+	}
+	var evicted uint64
+	if q.wal != nil {
+		queued += q.wal.Len()
+		evicted = q.wal.Evicted()
+	}
+	q.mu.Unlock()
+
+	return QueueStats{
+		Queued:  queued,
+		Spilled: atomic.LoadUint64(&q.spilled),
+		Dropped: atomic.LoadUint64(&q.dropped),
+		Evicted: evicted,
+	}
+}
+
+func (q *Queue) consume() {
+	defer close(q.stopped)
+
+	for {
+		entries := q.nextBatch()
+		if len(entries) == 0 {
+			return
+		}
+
+		q.handler(q.ctx, entries)
+		q.commit()
+		for range entries {
+			q.pending.Done()
+		}
+	}
+}
+
+// nextBatch waits for the first entry and then up to MaxWait for the batch to fill,
+// empty result means the queue is stopped
+func (q *Queue) nextBatch() []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var entries []Entry
+	var deadline bool
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for q.ctx.Err() == nil {
+		if entry, ok := q.pop(); ok {
+			entries = append(entries, entry)
+			if len(entries) >= q.batch.MaxEntries {
+				return entries
+			}
+			continue
+		}
+
+		if len(entries) > 0 && (deadline || q.closed || q.batch.MaxWait <= 0) {
+			return entries
+		}
+
+		if len(entries) > 0 && timer == nil {
+			timer = time.AfterFunc(q.batch.MaxWait, func() {
+				q.mu.Lock()
+				deadline = true
+				q.notEmpty.Broadcast()
+				q.mu.Unlock()
+			})
+		}
+
+		q.notEmpty.Wait()
+	}
+
+	return nil
+}
+
+func (q *Queue) pop() (entry Entry, ok bool) {
+	if q.wal != nil {
+		return q.popPersisted()
+	}
+
+	for {
+		if len(q.items) > 0 {
+			entry = q.items[0]
+			q.items[0] = Entry{}
+			q.items = q.items[1:]
+			q.notFull.Signal()
+			return entry, true
+		}
+
+		if q.spill == nil || q.spill.count == 0 {
+			return
+		}
+
+		var err error
+		entry, err = q.spill.read()
+		if err != nil {
+			printQueueError(err, "error during reading spilled log entry")
+			q.pending.Done()
+			continue
+		}
+		return entry, true
+	}
+}
+
+// persist writes entry to write-ahead log without holding mu, so slow disk does not block consumer and Stats
+func (q *Queue) persist(entry Entry) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		atomic.AddUint64(&q.dropped, 1)
+		return
+	}
+	q.appending.Add(1)
+	q.pending.Add()
+	q.mu.Unlock()
+	defer q.appending.Done()
+
+	data, err := encodeEntry(entry)
+	if err == nil {
+		err = q.wal.Append(data)
+	}
+	if err != nil {
+		atomic.AddUint64(&q.dropped, 1)
+		q.pending.Done()
+		printQueueError(err, "error during writing log entry to disk buffer")
+		return
+	}
+
+	q.mu.Lock()
+	// entries evicted by disk limit will never be handled
+	for evicted := q.wal.Evicted(); q.walEvicted < evicted; q.walEvicted++ {
+		q.pending.Done()
+	}
+	q.notEmpty.Signal()
+	q.mu.Unlock()
+}
+
+func (q *Queue) popPersisted() (entry Entry, ok bool) {
+	for {
+		data, ok, err := q.wal.Next()
+		if err != nil {
+			printQueueError(err, "error during reading log entry from disk buffer")
+			return entry, false
+		}
+		if !ok {
+			return entry, false
+		}
+
+		if entry, err = decodeEntry(data); err != nil {
+			printQueueError(err, "error during decoding log entry from disk buffer")
+			q.pending.Done()
+			continue
+		}
+		return entry, true
+	}
+}
+
+// commit acknowledges handled persistent entries, entries handled after Close are replayed on the next start
+func (q *Queue) commit() {
+	if q.wal == nil || q.ctx.Err() != nil {
+		return
+	}
+
+	if err := q.wal.Commit(); err != nil {
+		printQueueError(err, "error during committing disk buffer position")
+	}
+}
+
+func openSpillFile(path string, maxBytes int64) (*spillFile, error) {
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, ConfigError.Wrap(err)
+	}
+
+	reader, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, ConfigError.Wrap(err)
+	}
+
+	return &spillFile{
+		writer:   writer,
+		reader:   reader,
+		buffered: bufio.NewReader(reader),
+		maxBytes: maxBytes,
+	}, nil
+}
+
+// spillFile keeps overflowed entries as encoded json lines, it is truncated every time all of them are read
+type spillFile struct {
+	writer   *os.File
+	reader   *os.File
+	buffered *bufio.Reader
+	size     int64
+	maxBytes int64
+	count    int
+}
+
+func (s *spillFile) write(entry Entry) error {
+	data, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if s.maxBytes > 0 && s.size+int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("spill file size limit %d bytes is reached", s.maxBytes)
+	}
+
+	n, err := s.writer.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	s.count++
+
+	return nil
+}
+
+func (s *spillFile) read() (entry Entry, err error) {
+	line, err := s.buffered.ReadBytes('\n')
+	s.count--
+	if s.count == 0 {
+		if resetErr := s.reset(); resetErr != nil && err == nil {
+			err = resetErr
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	return decodeEntry(line)
+}
+
+func (s *spillFile) reset() (err error) {
+	if err = s.writer.Truncate(0); err != nil {
+		return
+	}
+	if _, err = s.reader.Seek(0, 0); err != nil {
+		return
+	}
+	s.buffered.Reset(s.reader)
+	s.size = 0
+
+	return
+}
+
+func (s *spillFile) close() error {
+	s.reader.Close()
+	return s.writer.Close()
+}
+
+func printQueueError(err error, message string) {
+	fmt.Println(fmt.Sprintf(`{"error":%q,"message":%q,"time":"%s"}`,
+		err.Error(), message, time.Now().UTC().Format(time.RFC3339)))
+}
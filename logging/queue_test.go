@@ -0,0 +1,363 @@
+package logging
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golibs/logging/wal"
+)
+
+// gatedHandler records handled entries and blocks every entry until release is closed
+type gatedHandler struct {
+	mu      sync.Mutex
+	texts   []string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGatedHandler() *gatedHandler {
+	return &gatedHandler{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (h *gatedHandler) handle(_ context.Context, entry Entry) {
+	h.started <- struct{}{}
+	<-h.release
+
+	h.mu.Lock()
+	h.texts = append(h.texts, entry.Text)
+	h.mu.Unlock()
+}
+
+func (h *gatedHandler) handled() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string(nil), h.texts...)
+}
+
+// pushBusy pushes the first entry and waits until consumer is blocked in handler with it
+func (h *gatedHandler) pushBusy(t *testing.T, q *Queue, text string) {
+	q.Push(Entry{Text: text})
+	select {
+	case <-h.started:
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not start handling entry")
+	}
+}
+
+func flushQueue(t *testing.T, q *Queue) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+}
+
+func TestQueueOverflowBlockWaitsForSpace(t *testing.T) {
+	handler := newGatedHandler()
+	q, err := NewQueue(QueueConfig{Capacity: 1, Overflow: OverflowBlock}, handler.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	handler.pushBusy(t, q, "a")
+	q.Push(Entry{Text: "b"})
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(Entry{Text: "c"})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push into full BLOCK queue returned before entry was consumed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.release)
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push into BLOCK queue did not return after entry was consumed")
+	}
+
+	flushQueue(t, q)
+	if texts := handler.handled(); !reflect.DeepEqual(texts, []string{"a", "b", "c"}) {
+		t.Errorf("handled %v, expected [a b c]", texts)
+	}
+	if stats := q.Stats(); stats.Dropped != 0 {
+		t.Errorf("BLOCK queue dropped %d entries", stats.Dropped)
+	}
+}
+
+func TestQueueOverflowDrop(t *testing.T) {
+	for _, test := range []struct {
+		overflow OverflowPolicy
+		expected []string
+	}{
+		{overflow: OverflowDropNewest, expected: []string{"a", "b"}},
+		{overflow: OverflowDropOldest, expected: []string{"a", "d"}},
+	} {
+		t.Run(string(test.overflow), func(t *testing.T) {
+			handler := newGatedHandler()
+			q, err := NewQueue(QueueConfig{Capacity: 1, Overflow: test.overflow}, handler.handle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer q.Close()
+
+			handler.pushBusy(t, q, "a")
+			q.Push(Entry{Text: "b"})
+			q.Push(Entry{Text: "c"})
+			q.Push(Entry{Text: "d"})
+
+			if stats := q.Stats(); stats.Queued != 1 || stats.Dropped != 2 {
+				t.Errorf("stats %+v, expected 1 queued and 2 dropped", stats)
+			}
+
+			close(handler.release)
+			flushQueue(t, q)
+			if texts := handler.handled(); !reflect.DeepEqual(texts, test.expected) {
+				t.Errorf("handled %v, expected %v", texts, test.expected)
+			}
+		})
+	}
+}
+
+func TestQueueFlushWaitsForHandledEntries(t *testing.T) {
+	handler := newGatedHandler()
+	q, err := NewQueue(QueueConfig{Capacity: 10, Overflow: OverflowBlock}, handler.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	handler.pushBusy(t, q, "a")
+	q.Push(Entry{Text: "b"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Flush(ctx); err == nil {
+		t.Fatal("flush returned before queued entries were handled")
+	}
+
+	close(handler.release)
+	flushQueue(t, q)
+	if texts := handler.handled(); len(texts) != 2 {
+		t.Errorf("handled %v after flush, expected both entries", texts)
+	}
+}
+
+func TestQueueCloseDrainsEntries(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	q, err := NewQueue(QueueConfig{Capacity: 10, Overflow: OverflowBlock}, func(_ context.Context, entry Entry) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		texts = append(texts, entry.Text)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		q.Push(Entry{Text: text})
+	}
+	if err = q.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(texts, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("handled %v before close returned, expected every queued entry", texts)
+	}
+
+	q.Push(Entry{Text: "late"})
+	if stats := q.Stats(); stats.Dropped != 1 {
+		t.Errorf("entry pushed after close is not counted as dropped, stats %+v", stats)
+	}
+}
+
+func TestQueueConfigValidate(t *testing.T) {
+	persistent := &wal.Config{Dir: "unused"}
+	for _, test := range []struct {
+		name  string
+		conf  QueueConfig
+		valid bool
+	}{
+		{name: "memory", conf: QueueConfig{Capacity: 1, Overflow: OverflowDropNewest}, valid: true},
+		{name: "no capacity", conf: QueueConfig{Overflow: OverflowBlock}},
+		{name: "no overflow", conf: QueueConfig{Capacity: 1}},
+		{name: "spill without path", conf: QueueConfig{Capacity: 1, Overflow: OverflowSpill}},
+		{name: "persistent without capacity and overflow", conf: QueueConfig{Persistent: persistent}, valid: true},
+		{name: "persistent with spill", conf: QueueConfig{Persistent: persistent, Overflow: OverflowSpill, SpillPath: "spill"}},
+	} {
+		if err := test.conf.validate(); (err == nil) != test.valid {
+			t.Errorf("%s: validate returned %v, expected valid %t", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestPersistentQueueWithoutOverflow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	handler := newGatedHandler()
+	close(handler.release)
+	q, err := NewQueue(QueueConfig{Persistent: &wal.Config{Dir: dir}}, handler.handle)
+	if err != nil {
+		t.Fatalf("persistent queue without overflow policy is rejected: %v", err)
+	}
+	defer q.Close()
+
+	q.Push(Entry{Text: "a"})
+	flushQueue(t, q)
+	if texts := handler.handled(); !reflect.DeepEqual(texts, []string{"a"}) {
+		t.Errorf("handled %v, expected [a]", texts)
+	}
+}
+
+func TestQueueOverflowSpillKeepsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	handler := newGatedHandler()
+	q, err := NewQueue(QueueConfig{Capacity: 1, Overflow: OverflowSpill, SpillPath: filepath.Join(dir, "spill")}, handler.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	handler.pushBusy(t, q, "a")
+	for _, text := range []string{"b", "c", "d"} {
+		q.Push(Entry{Text: text, Fields: []LogField{{Name: "text", Value: text}}})
+	}
+	if stats := q.Stats(); stats.Queued != 3 || stats.Spilled != 2 || stats.Dropped != 0 {
+		t.Errorf("stats %+v, expected 3 queued and 2 spilled", stats)
+	}
+
+	close(handler.release)
+	flushQueue(t, q)
+	if texts := handler.handled(); !reflect.DeepEqual(texts, []string{"a", "b", "c", "d"}) {
+		t.Errorf("handled %v, expected spilled entries after memory ones in push order", texts)
+	}
+}
+
+func TestQueueOverflowSpillDropsAboveLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	handler := newGatedHandler()
+	conf := QueueConfig{Capacity: 1, Overflow: OverflowSpill, SpillPath: filepath.Join(dir, "spill"), SpillMaxBytes: 1}
+	q, err := NewQueue(conf, handler.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	handler.pushBusy(t, q, "a")
+	q.Push(Entry{Text: "b"})
+	q.Push(Entry{Text: "c"})
+	if stats := q.Stats(); stats.Spilled != 0 || stats.Dropped != 1 {
+		t.Errorf("stats %+v, expected entry above spill limit to be dropped", stats)
+	}
+
+	close(handler.release)
+	flushQueue(t, q)
+	if texts := handler.handled(); !reflect.DeepEqual(texts, []string{"a", "b"}) {
+		t.Errorf("handled %v, expected [a b]", texts)
+	}
+}
+
+func TestPersistentQueueReplaysAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := QueueConfig{Persistent: &wal.Config{Dir: dir}}
+
+	// entries left on disk by the process which stopped before handling them
+	log, err := wal.Open(*conf.Persistent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"a", "b", "c"} {
+		data, err := encodeEntry(Entry{Text: text, Fields: []LogField{{Name: "text", Value: text}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = log.Append(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var replayed []Entry
+	handler := func(_ context.Context, entry Entry) {
+		mu.Lock()
+		replayed = append(replayed, entry)
+		mu.Unlock()
+	}
+
+	q, err := NewQueue(conf, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushQueue(t, q)
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if len(replayed) != 3 {
+		t.Fatalf("replayed %d entries, expected 3", len(replayed))
+	}
+	for i, text := range []string{"a", "b", "c"} {
+		if replayed[i].Text != text || FieldString(replayed[i].Fields, "text") != text {
+			t.Errorf("replayed entry %d is %+v, expected %q with its fields", i, replayed[i], text)
+		}
+	}
+	replayed = nil
+	mu.Unlock()
+
+	// handled entries are committed and are not replayed again
+	q, err = NewQueue(conf, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := q.Stats(); stats.Queued != 0 {
+		t.Errorf("reopened queue has %d entries after every entry was handled", stats.Queued)
+	}
+	q.Push(Entry{Text: "d"})
+	flushQueue(t, q)
+	q.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(replayed) != 1 || replayed[0].Text != "d" {
+		t.Errorf("reopened queue handled %+v, expected only new entry", replayed)
+	}
+}
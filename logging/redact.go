@@ -0,0 +1,363 @@
+package logging
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultRedactionMask = "[REDACTED]"
+
+	redactTagName  = "log"
+	redactTagValue = "redact"
+
+	maxRedactionDepth = 32
+)
+
+var (
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// PanPattern matches card number candidates, only candidates passing Luhn check are masked
+	PanPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	JwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+	DefaultRedactionKeys = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token",
+		"authorization", "api_key", "card_number", "pan", "cvv", "cvc"}
+	DefaultRedactionPatterns = []*regexp.Regexp{EmailPattern, PanPattern, JwtPattern}
+
+	// fields always kept in deny by default mode, request and response bodies are not among them
+	redactionSafeFields = map[string]bool{
+		LogLvlFieldKey:        true,
+		MessageFieldKey:       true,
+		TimeFieldKey:          true,
+		ErrorFieldKey:         true,
+		RequestIdFieldKey:     true,
+		PathLogKey:            true,
+		StatusCodeFieldKey:    true,
+		LatencyFieldKey:       true,
+		MethodFieldKey:        true,
+		ResponseErrorFieldKey: true,
+		RemoteAddressFieldKey: true,
+		RequestUserUidKey:     true,
+		"env_name":            true,
+		"branch":              true,
+		"commit":              true,
+	}
+
+	jsonNumberType      = reflect.TypeOf(json.Number(""))
+	objectMarshalerType = reflect.TypeOf((*ObjectMarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	errorType           = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType        = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+type RedactionConfig struct {
+	// Keys masks fields and nested object keys with listed names, case insensitive
+	Keys []string
+	// Paths masks values by dot separated path starting from field name, e.g. "request.card.number",
+	// "*" matches any single key or array index
+	Paths []string
+	// Patterns masks matching parts of string values
+	Patterns []*regexp.Regexp
+	// DenyByDefault masks every value which is not allowed by AllowKeys or AllowPaths,
+	// logger own fields like level, message or request_id are always allowed
+	DenyByDefault bool
+	AllowKeys     []string
+	AllowPaths    []string
+	// Mask replaces redacted values, DefaultRedactionMask is used when empty
+	Mask string
+}
+
+// DefaultRedactionConfig masks common credential keys, emails, card numbers and JWTs
+func DefaultRedactionConfig() RedactionConfig {
+	return RedactionConfig{
+		Keys:     DefaultRedactionKeys,
+		Patterns: DefaultRedactionPatterns,
+	}
+}
+
+// NewRedactor builds redaction stage applied to entry fields before they reach printers,
+// values of struct fields tagged with `log:"redact"` are always masked
+func NewRedactor(conf RedactionConfig) *Redactor {
+	r := &Redactor{
+		keys:          lowerSet(conf.Keys),
+		paths:         splitPaths(conf.Paths),
+		patterns:      conf.Patterns,
+		denyByDefault: conf.DenyByDefault,
+		allowKeys:     lowerSet(conf.AllowKeys),
+		allowPaths:    splitPaths(conf.AllowPaths),
+		mask:          conf.Mask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultRedactionMask
+	}
+
+	return r
+}
+
+type Redactor struct {
+	keys          map[string]bool
+	paths         [][]string
+	patterns      []*regexp.Regexp
+	denyByDefault bool
+	allowKeys     map[string]bool
+	allowPaths    [][]string
+	mask          string
+}
+
+// Redact returns copy of fields with sensitive values masked, original values are not modified
+func (r *Redactor) Redact(fields []LogField) []LogField {
+	result := make([]LogField, len(fields))
+	for i, field := range fields {
+		result[i] = LogField{
+			Name:  field.Name,
+			Value: r.redact([]string{field.Name}, reflect.ValueOf(field.Value), redactionSafeFields[field.Name]),
+		}
+	}
+
+	return result
+}
+
+// RedactString applies pattern rules to a single string value
+func (r *Redactor) RedactString(value string) string {
+	for _, pattern := range r.patterns {
+		if pattern == PanPattern {
+			value = pattern.ReplaceAllStringFunc(value, func(candidate string) string {
+				if luhnValid(candidate) {
+					return r.mask
+				}
+				return candidate
+			})
+			continue
+		}
+		value = pattern.ReplaceAllString(value, r.mask)
+	}
+
+	return value
+}
+
+func (r *Redactor) redact(path []string, value reflect.Value, allowed bool) interface{} {
+	key := strings.ToLower(path[len(path)-1])
+	if r.keys[key] || matchAnyPath(r.paths, path) {
+		return r.mask
+	}
+	allowed = allowed || r.allowKeys[key] || matchAnyPath(r.allowPaths, path)
+
+	if len(path) > maxRedactionDepth {
+		return r.mask
+	}
+
+	if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return nil
+	}
+
+	if value.Type().Implements(objectMarshalerType) {
+		return r.redactObject(path, value.Interface().(ObjectMarshaler), allowed)
+	}
+	if value.Type().Implements(jsonMarshalerType) || value.Type().Implements(textMarshalerType) {
+		return r.leaf(value.Interface(), allowed)
+	}
+	// errors and stringers are printed as text, walking their unexported fields gives empty objects
+	if value.Type().Implements(errorType) {
+		return r.leaf(value.Interface().(error).Error(), allowed)
+	}
+	if (value.Kind() == reflect.Struct || value.Kind() == reflect.Ptr) && value.Type().Implements(stringerType) {
+		return r.leaf(value.Interface().(fmt.Stringer).String(), allowed)
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return r.redact(path, value.Elem(), allowed)
+	case reflect.String:
+		if value.Type() == jsonNumberType {
+			return r.redactNumber(json.Number(value.String()), allowed)
+		}
+		return r.redactText(path, value.String(), allowed)
+	case reflect.Struct:
+		result := make(map[string]interface{}, value.NumField())
+		r.redactStruct(path, value, allowed, result)
+		return result
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			name := fmt.Sprint(iter.Key().Interface())
+			result[name] = r.redact(appendPath(path, name), iter.Value(), allowed)
+		}
+		return result
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return r.leaf(nil, allowed)
+		}
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return []byte(r.redactText(path, string(value.Bytes()), allowed))
+		}
+		result := make([]interface{}, value.Len())
+		for i := range result {
+			result[i] = r.redact(appendPath(path, strconv.Itoa(i)), value.Index(i), allowed)
+		}
+		return result
+	default:
+		return r.leaf(value.Interface(), allowed)
+	}
+}
+
+func (r *Redactor) redactStruct(path []string, value reflect.Value, allowed bool, result map[string]interface{}) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				r.redactStruct(path, value.Field(i), allowed, result)
+				continue
+			}
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			r.redactStruct(path, value.Field(i), allowed, result)
+			continue
+		}
+
+		if field.Tag.Get(redactTagName) == redactTagValue {
+			result[name] = r.mask
+			continue
+		}
+		result[name] = r.redact(appendPath(path, name), value.Field(i), allowed)
+	}
+}
+
+// redactText applies key and path rules to JSON object or array bodies logged as text, other text is a leaf
+func (r *Redactor) redactText(path []string, text string, allowed bool) string {
+	if trimmed := strings.TrimSpace(text); trimmed != "" && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+
+		var body interface{}
+		if decoder.Decode(&body) == nil {
+			if data, err := json.Marshal(r.redact(path, reflect.ValueOf(body), allowed)); err == nil {
+				return string(data)
+			}
+		}
+	}
+
+	return r.leaf(text, allowed).(string)
+}
+
+// redactObject applies rules to JSON written by value itself, redacted object stays JSON object in output
+func (r *Redactor) redactObject(path []string, value ObjectMarshaler, allowed bool) interface{} {
+	redacted := r.redactText(path, string(appendJsonObject(nil, value)), allowed)
+	if !json.Valid([]byte(redacted)) {
+		return redacted
+	}
+
+	return json.RawMessage(redacted)
+}
+
+// redactNumber keeps numbers of parsed JSON bodies as numbers unless pattern rules mask them
+func (r *Redactor) redactNumber(number json.Number, allowed bool) interface{} {
+	if masked := r.leaf(number.String(), allowed).(string); masked != number.String() {
+		return masked
+	}
+
+	return number
+}
+
+func (r *Redactor) leaf(value interface{}, allowed bool) interface{} {
+	if r.denyByDefault && !allowed {
+		return r.mask
+	}
+
+	if str, ok := value.(string); ok {
+		return r.RedactString(str)
+	}
+
+	return value
+}
+
+func appendPath(path []string, name string) []string {
+	result := make([]string, len(path), len(path)+1)
+	copy(result, path)
+	return append(result, name)
+}
+
+func matchAnyPath(patterns [][]string, path []string) bool {
+	for _, pattern := range patterns {
+		if len(pattern) != len(path) {
+			continue
+		}
+
+		matched := true
+		for i := range pattern {
+			if pattern[i] != "*" && !strings.EqualFold(pattern[i], path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitPaths(paths []string) [][]string {
+	result := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+		path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+		result = append(result, strings.Split(path, "."))
+	}
+
+	return result
+}
+
+func lowerSet(values []string) map[string]bool {
+	result := make(map[string]bool, len(values))
+	for _, value := range values {
+		result[strings.ToLower(value)] = true
+	}
+
+	return result
+}
+
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
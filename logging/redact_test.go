@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type redactCard struct {
+	Number string `json:"number"`
+	Holder string `json:"holder"`
+	Cvv    string `json:"cvv" log:"redact"`
+}
+
+func redactField(conf RedactionConfig, name string, value interface{}) interface{} {
+	conf.Mask = "***"
+	return NewRedactor(conf).Redact([]LogField{{Name: name, Value: value}})[0].Value
+}
+
+func TestRedactorKeys(t *testing.T) {
+	conf := RedactionConfig{Keys: []string{"Password", "token"}}
+
+	if got := redactField(conf, "password", "secret"); got != "***" {
+		t.Errorf("field with redacted key is %v", got)
+	}
+
+	got := redactField(conf, "body", map[string]interface{}{
+		"user":  "bob",
+		"TOKEN": "abc",
+		"items": []interface{}{map[string]interface{}{"password": "x"}},
+	})
+	expected := map[string]interface{}{
+		"user":  "bob",
+		"TOKEN": "***",
+		"items": []interface{}{map[string]interface{}{"password": "***"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("nested keys are redacted to %v, expected %v", got, expected)
+	}
+}
+
+func TestRedactorPaths(t *testing.T) {
+	conf := RedactionConfig{Paths: []string{"request.card.number", "response.items[*].token"}}
+
+	got := redactField(conf, "request", map[string]interface{}{
+		"card": map[string]interface{}{"number": "4111", "holder": "bob"},
+	})
+	expected := map[string]interface{}{
+		"card": map[string]interface{}{"number": "***", "holder": "bob"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("request is redacted to %v, expected %v", got, expected)
+	}
+
+	got = redactField(conf, "response", map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"token": "a"}, map[string]interface{}{"token": "b"}},
+	})
+	expected = map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"token": "***"}, map[string]interface{}{"token": "***"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("response is redacted to %v, expected %v", got, expected)
+	}
+}
+
+func TestRedactorPatterns(t *testing.T) {
+	conf := RedactionConfig{Patterns: DefaultRedactionPatterns}
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"mail bob@example.com now", "mail *** now"},
+		{"card 4111 1111 1111 1111", "card ***"},
+		{"order 1234567890123", "order 1234567890123"},
+		{"auth eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig", "auth ***"},
+	}
+	for _, test := range tests {
+		if got := redactField(conf, "message_text", test.value); got != test.expected {
+			t.Errorf("%q is redacted to %q, expected %q", test.value, got, test.expected)
+		}
+	}
+}
+
+func TestRedactorStructTags(t *testing.T) {
+	got := redactField(RedactionConfig{Paths: []string{"card.number"}}, "card",
+		redactCard{Number: "4111", Holder: "bob", Cvv: "123"})
+	expected := map[string]interface{}{"number": "***", "holder": "bob", "cvv": "***"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("struct is redacted to %v, expected %v", got, expected)
+	}
+}
+
+func TestRedactorDenyByDefault(t *testing.T) {
+	conf := RedactionConfig{DenyByDefault: true, AllowKeys: []string{"holder"}, AllowPaths: []string{"order.id"}}
+
+	got := redactField(conf, "order", map[string]interface{}{"id": 7, "holder": "bob", "note": "x"})
+	expected := map[string]interface{}{"id": 7, "holder": "bob", "note": "***"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("order is redacted to %v, expected %v", got, expected)
+	}
+
+	if got := redactField(conf, RequestIdFieldKey, "id"); got != "id" {
+		t.Errorf("logger field is redacted to %v", got)
+	}
+}
+
+func TestRedactorTextBodies(t *testing.T) {
+	conf := RedactionConfig{Keys: []string{"password"}, Paths: []string{"request.card"}}
+
+	got := redactField(conf, "request", `{"card":"4111","password":"x","amount":10.50}`)
+	if expected := `{"amount":10.50,"card":"***","password":"***"}`; got != expected {
+		t.Errorf("JSON string body is redacted to %v, expected %v", got, expected)
+	}
+
+	got = redactField(conf, "request", []byte(`{"password":"x"}`))
+	if expected := []byte(`{"password":"***"}`); !reflect.DeepEqual(got, expected) {
+		t.Errorf("JSON bytes body is redacted to %s, expected %s", got, expected)
+	}
+
+	if got := redactField(conf, "response", "{not json"); got != "{not json" {
+		t.Errorf("plain text is redacted to %v", got)
+	}
+}
+
+func TestRedactorObjectMarshaler(t *testing.T) {
+	conf := RedactionConfig{Keys: []string{"password"}}
+	got := redactField(conf, "user", encoderUser{id: 1, name: "bob", password: "x"})
+
+	expected := `{"id":1,"name":"bob","password":"***"}`
+	if raw, ok := got.(json.RawMessage); !ok || string(raw) != expected {
+		t.Errorf("object is redacted to %#v, expected JSON %s", got, expected)
+	}
+
+	conf = RedactionConfig{DenyByDefault: true, AllowKeys: []string{"id"}}
+	got = redactField(conf, "user", encoderUser{id: 1, name: "bob"})
+	expected = `{"id":1,"name":"***","password":"***"}`
+	if raw, ok := got.(json.RawMessage); !ok || string(raw) != expected {
+		t.Errorf("object is redacted to %#v in deny by default mode, expected JSON %s", got, expected)
+	}
+}
+
+type redactAddress struct {
+	host string
+}
+
+func (a redactAddress) String() string {
+	return "mail " + a.host
+}
+
+func TestRedactorErrorsAndStringers(t *testing.T) {
+	conf := RedactionConfig{Patterns: DefaultRedactionPatterns}
+
+	if got := redactField(conf, "cause", errors.New("boom for bob@example.com")); got != "boom for ***" {
+		t.Errorf("error is redacted to %#v", got)
+	}
+	if got := redactField(conf, "address", redactAddress{host: "bob@example.com"}); got != "mail ***" {
+		t.Errorf("stringer is redacted to %#v", got)
+	}
+	if got := redactField(conf, "address", &redactAddress{host: "x"}); got != "mail x" {
+		t.Errorf("stringer pointer is redacted to %#v", got)
+	}
+
+	got := redactField(conf, "body", map[string]interface{}{"cause": errors.New("boom")})
+	if expected := map[string]interface{}{"cause": "boom"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("nested error is redacted to %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// RenameReservedFields writes reserved field of unexpected type under custom_ prefixed name
+	RenameReservedFields ReservedFieldPolicy = "RENAME"
+	// RejectReservedFields drops reserved field of unexpected type and prints error to stdout
+	RejectReservedFields ReservedFieldPolicy = "REJECT"
+	// CoerceReservedFields writes reserved field of unexpected type as its printed string
+	CoerceReservedFields ReservedFieldPolicy = "COERCE"
+
+	reservedFieldPrefix = "custom_"
+)
+
+var reservedFieldPolicies = map[ReservedFieldPolicy]bool{
+	RenameReservedFields: true,
+	RejectReservedFields: true,
+	CoerceReservedFields: true,
+}
+
+type reservedKind int
+
+const (
+	stringKind reservedKind = iota
+	intKind
+	// durationKind accepts time.Duration and float seconds or milliseconds written by http middleware
+	durationKind
+	// anyKind is used by request and response bodies, which are logged as strings, maps or structs
+	anyKind
+)
+
+// reservedFields are names written by logger, drivers and middleware, every kind also accepts string values
+var reservedFields = map[string]reservedKind{
+	LogLvlFieldKey:        stringKind,
+	MessageFieldKey:       stringKind,
+	TimeFieldKey:          stringKind,
+	ErrorFieldKey:         stringKind,
+	RequestIdFieldKey:     stringKind,
+	PathLogKey:            stringKind,
+	StatusCodeFieldKey:    intKind,
+	LatencyFieldKey:       durationKind,
+	MethodFieldKey:        stringKind,
+	RequestFieldKey:       anyKind,
+	ResponseFieldKey:      anyKind,
+	ResponseErrorFieldKey: stringKind,
+	RemoteAddressFieldKey: stringKind,
+	RequestUserUidKey:     stringKind,
+	CallerFieldKey:        stringKind,
+	FunctionFieldKey:      stringKind,
+	StackFieldKey:         stringKind,
+}
+
+// ReservedFieldPolicy decides what happens with field using reserved name, e.g. status_code, with value of unexpected type
+type ReservedFieldPolicy string
+
+func ParseReservedFieldPolicy(value string) (ReservedFieldPolicy, error) {
+	policy := ReservedFieldPolicy(strings.ToUpper(strings.TrimSpace(value)))
+	if !reservedFieldPolicies[policy] {
+		return "", ConfigError.NewF("unknown reserved field policy %q, expected one of RENAME, REJECT, COERCE", value)
+	}
+
+	return policy, nil
+}
+
+func (p ReservedFieldPolicy) String() string {
+	return string(p)
+}
+
+func (p *ReservedFieldPolicy) Set(value string) (err error) {
+	*p, err = ParseReservedFieldPolicy(value)
+	return
+}
+
+// apply returns field allowed by policy, ok is false when field is rejected
+func (p ReservedFieldPolicy) apply(field LogField) (result LogField, ok bool) {
+	kind, reserved := reservedFields[field.Name]
+	if !reserved || kind.accepts(field.Value) {
+		return field, true
+	}
+
+	switch p {
+	case RejectReservedFields:
+		printQueueError(FieldError.NewF("reserved field %q does not accept value of type %T", field.Name, field.Value),
+			"log field is dropped")
+		return field, false
+	case CoerceReservedFields:
+		field.Value = FormatValue(field.Value)
+		return field, true
+	default:
+		field.Name = reservedFieldPrefix + field.Name
+		return field, true
+	}
+}
+
+func (k reservedKind) accepts(value interface{}) bool {
+	switch value.(type) {
+	case string:
+		return true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return k == intKind || k == anyKind
+	case time.Duration, float32, float64:
+		return k == durationKind || k == anyKind
+	}
+
+	return k == anyKind
+}
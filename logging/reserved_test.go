@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fieldsPrinter struct {
+	fields []LogField
+}
+
+func (p *fieldsPrinter) Print(_ string, fields []LogField) {
+	p.fields = fields
+}
+
+func TestReservedFieldsAcceptMiddlewareValues(t *testing.T) {
+	body := map[string]interface{}{"card": "4111", "amount": 10}
+
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{RequestFieldKey, body},
+		{ResponseFieldKey, struct{ Status string }{"ok"}},
+		{LatencyFieldKey, 0.25},
+		{LatencyFieldKey, 250 * time.Millisecond},
+		{StatusCodeFieldKey, 200},
+		{RequestIdFieldKey, "id"},
+	}
+	for _, test := range tests {
+		for _, policy := range []ReservedFieldPolicy{RenameReservedFields, RejectReservedFields, CoerceReservedFields} {
+			field, ok := policy.apply(LogField{Name: test.name, Value: test.value})
+			if !ok || field.Name != test.name || !reflect.DeepEqual(field.Value, test.value) {
+				t.Errorf("%s policy changes %s field %#v to %#v, kept %v", policy, test.name, test.value, field, ok)
+			}
+		}
+	}
+}
+
+func TestReservedFieldsPolicies(t *testing.T) {
+	field := LogField{Name: StatusCodeFieldKey, Value: 1.5}
+
+	if got, ok := RenameReservedFields.apply(field); !ok || got.Name != "custom_status_code" {
+		t.Errorf("renamed field is %v", got)
+	}
+	if got, ok := CoerceReservedFields.apply(field); !ok || got.Value != "1.5" {
+		t.Errorf("coerced field is %v", got)
+	}
+	if _, ok := RejectReservedFields.apply(field); ok {
+		t.Error("field of unexpected type is not rejected")
+	}
+}
+
+func TestRequestBodyReachesDenyFieldsAndRedaction(t *testing.T) {
+	recorded := &fieldsPrinter{}
+	printer, err := NewConfiguredPrinter(recorded, PrinterConfig{DenyFields: []string{RequestFieldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := buildLogger([]Printer{printer}, NewJsonFormatter(), DebugLevel)
+	l.redactor = NewRedactor(RedactionConfig{Paths: []string{"request.card"}, Mask: "***"})
+	body := map[string]interface{}{"card": "4111", "amount": 10}
+
+	l.WithField(RequestFieldKey, body).Info("handled")
+	if _, ok := FieldValue(recorded.fields, RequestFieldKey); ok {
+		t.Error("request field is not removed by deny list")
+	}
+	if _, ok := FieldValue(recorded.fields, reservedFieldPrefix+RequestFieldKey); ok {
+		t.Error("request field is renamed")
+	}
+
+	l.printers = []Printer{recorded}
+	l.WithField(RequestFieldKey, body).Info("handled")
+	request, _ := FieldValue(recorded.fields, RequestFieldKey)
+	if expected := map[string]interface{}{"card": "***", "amount": 10}; !reflect.DeepEqual(request, expected) {
+		t.Errorf("request is printed as %v, expected %v", request, expected)
+	}
+}
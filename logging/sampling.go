@@ -0,0 +1,209 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const RepeatedFieldKey = "repeated"
+
+type SamplingConfig struct {
+	// Interval of sampling window, each level and message pair has own window started by its first entry
+	Interval time.Duration
+	// First entries of each level and message pair are passed in every window
+	First uint64
+	// Thereafter passes every Thereafter-th entry after First ones, 0 drops the rest of window,
+	// at least one of First and Thereafter must be set
+	Thereafter uint64
+}
+
+type DedupConfig struct {
+	// Window suppresses repeats of the same level and message, the summary entry is written when it ends
+	Window time.Duration
+}
+
+// Stats contains counters of entries dropped before reaching printers
+type Stats struct {
+	Sampled      uint64
+	Deduplicated uint64
+}
+
+func (c SamplingConfig) validate() error {
+	if c.Interval <= 0 {
+		return ConfigError.NewF("sampling interval must be positive, got %s", c.Interval)
+	}
+	if c.First == 0 && c.Thereafter == 0 {
+		return ConfigError.New("sampling drops every entry when both first and thereafter are 0")
+	}
+
+	return nil
+}
+
+func (c DedupConfig) validate() error {
+	if c.Window <= 0 {
+		return ConfigError.NewF("dedup window must be positive, got %s", c.Window)
+	}
+
+	return nil
+}
+
+func entryKey(level Level, message string, fields []LogField) string {
+	key := level.String() + "\x00" + message
+	if err, ok := FieldValue(fields, ErrorFieldKey); ok {
+		key += "\x00" + FormatValue(err)
+	}
+
+	return key
+}
+
+func newSampler(conf SamplingConfig) *sampler {
+	return &sampler{
+		conf:    conf,
+		windows: map[string]*sampleWindow{},
+	}
+}
+
+type sampler struct {
+	conf      SamplingConfig
+	mu        sync.Mutex
+	windows   map[string]*sampleWindow
+	lastSweep time.Time
+	dropped   uint64
+}
+
+type sampleWindow struct {
+	start time.Time
+	count uint64
+}
+
+func (s *sampler) allow(key string) bool {
+	now := time.Now()
+
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) >= s.conf.Interval {
+		s.sweep(now)
+	}
+	window, ok := s.windows[key]
+	if !ok || now.Sub(window.start) >= s.conf.Interval {
+		window = &sampleWindow{start: now}
+		s.windows[key] = window
+	}
+	window.count++
+	count := window.count
+	s.mu.Unlock()
+
+	if count <= s.conf.First {
+		return true
+	}
+	if s.conf.Thereafter > 0 && (count-s.conf.First)%s.conf.Thereafter == 0 {
+		return true
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+	return false
+}
+
+// sweep removes ended windows so keys seen once do not stay in memory
+func (s *sampler) sweep(now time.Time) {
+	for key, window := range s.windows {
+		if now.Sub(window.start) >= s.conf.Interval {
+			delete(s.windows, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *sampler) droppedCount() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func newDeduplicator(conf DedupConfig) *deduplicator {
+	return &deduplicator{
+		window:  conf.Window,
+		entries: map[string]*dedupEntry{},
+	}
+}
+
+type deduplicator struct {
+	// root is logger returned by NewLogger, summaries carry its fields instead of fields of logger which saw the key first
+	root       *logger
+	window     time.Duration
+	mu         sync.Mutex
+	entries    map[string]*dedupEntry
+	suppressed uint64
+}
+
+type dedupEntry struct {
+	logger   *logger
+	level    Level
+	message  string
+	err      []LogField
+	repeated uint64
+	timer    *time.Timer
+}
+
+func (d *deduplicator) allow(key string, level Level, message string, fields []LogField) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry, ok := d.entries[key]; ok {
+		entry.repeated++
+		atomic.AddUint64(&d.suppressed, 1)
+		return false
+	}
+
+	entry := &dedupEntry{
+		logger:  d.root,
+		level:   level,
+		message: message,
+	}
+	if err, ok := FieldValue(fields, ErrorFieldKey); ok {
+		entry.err = []LogField{{Name: ErrorFieldKey, Value: err}}
+	}
+	entry.timer = time.AfterFunc(d.window, func() {
+		d.release(key, entry)
+	})
+	d.entries[key] = entry
+
+	return true
+}
+
+func (d *deduplicator) release(key string, entry *dedupEntry) {
+	d.mu.Lock()
+	if d.entries[key] == entry {
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+
+	entry.summarize()
+}
+
+// flush writes summaries of every pending window without waiting for its end
+func (d *deduplicator) flush() {
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = map[string]*dedupEntry{}
+	d.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.timer.Stop() {
+			entry.summarize()
+		}
+	}
+}
+
+func (d *deduplicator) suppressedCount() uint64 {
+	return atomic.LoadUint64(&d.suppressed)
+}
+
+func (e *dedupEntry) summarize() {
+	if e.repeated == 0 {
+		return
+	}
+
+	fields := append(e.logger.fields[:len(e.logger.fields):len(e.logger.fields)], e.err...)
+	fields = append(fields, LogField{Name: RepeatedFieldKey, Value: e.repeated})
+	e.logger.print(e.logger.createLog(e.level, fmt.Sprintf("%s (repeated %d times)", e.message, e.repeated), fields))
+}
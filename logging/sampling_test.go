@@ -0,0 +1,112 @@
+package logging_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golibs/logging"
+	"golibs/logging/logtest"
+)
+
+func newLogger(t *testing.T, config logging.Config) (logging.Logger, *logtest.Recorder) {
+	t.Helper()
+
+	recorder := logtest.NewRecorder()
+	logger, err := logging.NewLogger(config, []logging.Printer{recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return logger, recorder
+}
+
+func TestSamplingLimitsEntriesPerWindow(t *testing.T) {
+	logger, recorder := newLogger(t, logging.Config{
+		Sampling: &logging.SamplingConfig{Interval: time.Hour, First: 2, Thereafter: 3},
+	})
+
+	for i := 0; i < 8; i++ {
+		logger.Info("polling")
+	}
+	logger.Info("other message")
+	logger.Warn("polling")
+
+	// counts 1 and 2 pass as First, then every third: 5 and 8
+	if got := len(recorder.Find(logging.InfoLevel, "polling", nil)); got != 4 {
+		t.Errorf("%d sampled entries are printed, expected 4", got)
+	}
+	recorder.AssertLogged(t, logging.InfoLevel, "other message", nil)
+	recorder.AssertLogged(t, logging.WarningLevel, "polling", nil)
+	if sampled := logger.Stats().Sampled; sampled != 4 {
+		t.Errorf("%d entries are counted as sampled, expected 4", sampled)
+	}
+}
+
+func TestSamplingWindowResets(t *testing.T) {
+	logger, recorder := newLogger(t, logging.Config{
+		Sampling: &logging.SamplingConfig{Interval: 50 * time.Millisecond, First: 1},
+	})
+
+	logger.Info("tick")
+	logger.Info("tick")
+	time.Sleep(60 * time.Millisecond)
+	logger.Info("tick")
+
+	if got := len(recorder.Find(logging.InfoLevel, "tick", nil)); got != 2 {
+		t.Errorf("%d entries are printed, expected the first one of each window", got)
+	}
+}
+
+func TestSamplingRejectsDroppingEverything(t *testing.T) {
+	_, err := logging.NewLogger(logging.Config{Sampling: &logging.SamplingConfig{Interval: time.Second}}, nil)
+	if err == nil {
+		t.Error("sampling without first and thereafter is accepted")
+	}
+}
+
+func TestDedupWritesSummaryOnSync(t *testing.T) {
+	logger, recorder := newLogger(t, logging.Config{Dedup: &logging.DedupConfig{Window: time.Hour}})
+
+	for i := 0; i < 3; i++ {
+		logger.WithField("attempt", i).Error(errors.New("db is down"))
+	}
+	if got := len(recorder.Entries()); got != 1 {
+		t.Fatalf("%d entries are printed before window end, expected 1", got)
+	}
+
+	if err := logger.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	summary := recorder.AssertLogged(t, logging.ErrorLevel, "(repeated 2 times)", map[string]interface{}{
+		logging.RepeatedFieldKey: 2,
+		logging.ErrorFieldKey:    "db is down",
+	})
+	if _, ok := summary.Field("attempt"); ok {
+		t.Error("summary carries fields of the first repeated entry")
+	}
+	if deduplicated := logger.Stats().Deduplicated; deduplicated != 2 {
+		t.Errorf("%d entries are counted as deduplicated, expected 2", deduplicated)
+	}
+}
+
+func TestDedupWritesSummaryAtWindowEnd(t *testing.T) {
+	logger, recorder := newLogger(t, logging.Config{Dedup: &logging.DedupConfig{Window: 30 * time.Millisecond}})
+
+	logger.Warn("slow query")
+	logger.Warn("slow query")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Find(logging.WarningLevel, "repeated 1 times", nil)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("summary is not written at window end")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	logger.Warn("slow query")
+	if got := len(recorder.Find(logging.WarningLevel, "slow query", nil)); got != 3 {
+		t.Errorf("%d entries are printed, expected first, summary and first of the next window", got)
+	}
+}
@@ -0,0 +1,432 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golibs/errors"
+)
+
+const (
+	DefaultSegmentBytes = 8 << 20
+	DefaultMaxBytes     = 256 << 20
+
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+	headerSize    = 8
+	maxRecordSize = 64 << 20
+)
+
+var (
+	OpenError  = errors.NewWrapper("error during opening write-ahead log")
+	WriteError = errors.NewWrapper("error during writing write-ahead log")
+	ReadError  = errors.NewWrapper("error during reading write-ahead log")
+)
+
+type Config struct {
+	// Dir keeps segment files and committed read position, it is created when missing
+	Dir string
+	// SegmentBytes is the size after which new segment is started, defaults to 8MB
+	SegmentBytes int64
+	// MaxBytes caps total segments size, the oldest segments are evicted when it is exceeded, defaults to 256MB
+	MaxBytes int64
+	// Sync calls fsync after every append
+	Sync bool
+}
+
+type segment struct {
+	seq     uint64
+	size    int64
+	records int
+}
+
+type position struct {
+	seq    uint64
+	offset int64
+	index  int
+}
+
+// Log is append-only record log split into segments, records are read in append order
+// and are kept on disk until Commit, so uncommitted ones are read again after restart
+type Log struct {
+	mu       sync.Mutex
+	conf     Config
+	segments []*segment
+	writer   *os.File
+	reader   *os.File
+	read     position
+	commit   position
+	unread   int
+	evicted  uint64
+}
+
+func Open(conf Config) (*Log, error) {
+	if conf.Dir == "" {
+		return nil, OpenError.New("write-ahead log dir is not set")
+	}
+	if conf.SegmentBytes <= 0 {
+		conf.SegmentBytes = DefaultSegmentBytes
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = DefaultMaxBytes
+	}
+
+	if err := os.MkdirAll(conf.Dir, 0700); err != nil {
+		return nil, OpenError.Wrap(err)
+	}
+
+	l := &Log{conf: conf}
+	if err := l.load(); err != nil {
+		return nil, OpenError.Wrap(err)
+	}
+
+	return l, nil
+}
+
+// Append writes record to the active segment and evicts the oldest segments above MaxBytes
+func (l *Log) Append(record []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	active := l.segments[len(l.segments)-1]
+	if active.size > 0 && active.size+headerSize+int64(len(record)) > l.conf.SegmentBytes {
+		if err := l.startSegment(active.seq + 1); err != nil {
+			return WriteError.Wrap(err)
+		}
+		active = l.segments[len(l.segments)-1]
+	}
+
+	data := make([]byte, headerSize+len(record))
+	binary.LittleEndian.PutUint32(data, uint32(len(record)))
+	binary.LittleEndian.PutUint32(data[4:], crc32.ChecksumIEEE(record))
+	copy(data[headerSize:], record)
+
+	n, err := l.writer.Write(data)
+	active.size += int64(n)
+	if err != nil {
+		return WriteError.Wrap(err)
+	}
+	if l.conf.Sync {
+		if err = l.writer.Sync(); err != nil {
+			return WriteError.Wrap(err)
+		}
+	}
+	active.records++
+	l.unread++
+
+	return l.evict()
+}
+
+// Next returns the next unread record, ok is false when every record is read
+func (l *Log) Next() (record []byte, ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.unread > 0 {
+		current := l.segmentBySeq(l.read.seq)
+		if current == nil || l.read.offset >= current.size {
+			if err = l.advanceReader(); err != nil {
+				return nil, false, ReadError.Wrap(err)
+			}
+			continue
+		}
+
+		if l.reader == nil {
+			if l.reader, err = os.Open(l.segmentPath(l.read.seq)); err != nil {
+				return nil, false, ReadError.Wrap(err)
+			}
+		}
+
+		record, err = readRecord(l.reader, l.read.offset)
+		if err != nil {
+			return nil, false, ReadError.Wrap(err)
+		}
+
+		l.read.offset += headerSize + int64(len(record))
+		l.read.index++
+		l.unread--
+		return record, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// Commit marks every record returned by Next as consumed and removes fully consumed segments
+func (l *Log) Commit() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.commit = l.read
+	if err := l.saveCursor(); err != nil {
+		return WriteError.Wrap(err)
+	}
+
+	for len(l.segments) > 1 && l.segments[0].seq < l.commit.seq {
+		if err := os.Remove(l.segmentPath(l.segments[0].seq)); err != nil && !os.IsNotExist(err) {
+			return WriteError.Wrap(err)
+		}
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+// Len returns the number of unread records
+func (l *Log) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.unread
+}
+
+// Evicted returns the number of unread records removed because of MaxBytes limit
+func (l *Log) Evicted() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.evicted
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.reader != nil {
+		l.reader.Close()
+		l.reader = nil
+	}
+
+	return l.writer.Close()
+}
+
+func (l *Log) load() error {
+	files, err := ioutil.ReadDir(l.conf.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, &segment{seq: seq, size: file.Size()})
+	}
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].seq < l.segments[j].seq
+	})
+
+	if err = l.loadCursor(); err != nil {
+		return err
+	}
+
+	// segments before committed one are consumed, the rest are scanned for records count
+	kept := l.segments[:0]
+	for _, s := range l.segments {
+		if s.seq < l.commit.seq {
+			os.Remove(l.segmentPath(s.seq))
+			continue
+		}
+		if err = l.scan(s); err != nil {
+			return err
+		}
+		kept = append(kept, s)
+	}
+	l.segments = kept
+
+	if len(l.segments) == 0 || l.segments[0].seq > l.commit.seq {
+		l.commit = position{seq: l.commit.seq}
+		if len(l.segments) > 0 {
+			l.commit = position{seq: l.segments[0].seq}
+		}
+	}
+	l.read = l.commit
+
+	for _, s := range l.segments {
+		l.unread += s.records
+	}
+	l.unread -= l.commit.index
+	if l.unread < 0 {
+		l.unread = 0
+	}
+
+	if len(l.segments) == 0 {
+		return l.startSegment(l.commit.seq)
+	}
+
+	last := l.segments[len(l.segments)-1]
+	l.writer, err = os.OpenFile(l.segmentPath(last.seq), os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+// scan counts valid records of segment and truncates torn tail left by crash
+func (l *Log) scan(s *segment) error {
+	file, err := os.OpenFile(l.segmentPath(s.seq), os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var offset int64
+	for offset < s.size {
+		record, err := readRecord(file, offset)
+		if err != nil {
+			break
+		}
+		offset += headerSize + int64(len(record))
+		s.records++
+	}
+
+	if offset < s.size {
+		if err = file.Truncate(offset); err != nil {
+			return err
+		}
+		s.size = offset
+	}
+
+	return nil
+}
+
+func (l *Log) startSegment(seq uint64) (err error) {
+	if l.writer != nil {
+		if err = l.writer.Close(); err != nil {
+			return
+		}
+	}
+
+	l.writer, err = os.OpenFile(l.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	l.segments = append(l.segments, &segment{seq: seq})
+
+	return
+}
+
+func (l *Log) advanceReader() error {
+	if l.reader != nil {
+		l.reader.Close()
+		l.reader = nil
+	}
+
+	for _, s := range l.segments {
+		if s.seq > l.read.seq {
+			l.read = position{seq: s.seq}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("segment after %d is missing while %d records are unread", l.read.seq, l.unread)
+}
+
+func (l *Log) evict() error {
+	var total int64
+	for _, s := range l.segments {
+		total += s.size
+	}
+
+	for total > l.conf.MaxBytes && len(l.segments) > 1 {
+		oldest := l.segments[0]
+		switch {
+		case oldest.seq > l.read.seq:
+			l.unread -= oldest.records
+			l.evicted += uint64(oldest.records)
+		case oldest.seq == l.read.seq:
+			l.unread -= oldest.records - l.read.index
+			l.evicted += uint64(oldest.records - l.read.index)
+		}
+
+		if oldest.seq == l.read.seq {
+			if l.reader != nil {
+				l.reader.Close()
+				l.reader = nil
+			}
+			l.read = position{seq: l.segments[1].seq}
+		}
+		if oldest.seq >= l.commit.seq {
+			l.commit = position{seq: l.segments[1].seq}
+			if err := l.saveCursor(); err != nil {
+				return WriteError.Wrap(err)
+			}
+		}
+
+		if err := os.Remove(l.segmentPath(oldest.seq)); err != nil && !os.IsNotExist(err) {
+			return WriteError.Wrap(err)
+		}
+		total -= oldest.size
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+func (l *Log) segmentBySeq(seq uint64) *segment {
+	for _, s := range l.segments {
+		if s.seq == seq {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func (l *Log) segmentPath(seq uint64) string {
+	return filepath.Join(l.conf.Dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (l *Log) saveCursor() error {
+	path := filepath.Join(l.conf.Dir, cursorFile)
+	data := fmt.Sprintf("%d %d %d", l.commit.seq, l.commit.offset, l.commit.index)
+	if err := ioutil.WriteFile(path+".tmp", []byte(data), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (l *Log) loadCursor() error {
+	data, err := ioutil.ReadFile(filepath.Join(l.conf.Dir, cursorFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Sscanf(string(data), "%d %d %d", &l.commit.seq, &l.commit.offset, &l.commit.index)
+	return err
+}
+
+func readRecord(file io.ReaderAt, offset int64) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(header)
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("record size %d at offset %d exceeds limit", size, offset)
+	}
+
+	record := make([]byte, size)
+	if _, err := file.ReadAt(record, offset+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, fmt.Errorf("record checksum mismatch at offset %d", offset)
+	}
+
+	return record, nil
+}
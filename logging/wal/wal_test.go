@@ -0,0 +1,186 @@
+package wal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func openLog(t *testing.T, conf Config) *Log {
+	l, err := Open(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func appendRecords(t *testing.T, l *Log, from, to int) {
+	for i := from; i < to; i++ {
+		if err := l.Append([]byte(fmt.Sprintf("record-%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readRecords(t *testing.T, l *Log) []string {
+	var records []string
+	for {
+		record, ok, err := l.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return records
+		}
+		records = append(records, string(record))
+	}
+}
+
+func expectRecords(t *testing.T, records []string, from, to int) {
+	t.Helper()
+
+	if len(records) != to-from {
+		t.Fatalf("read %d records %v, expected records %d..%d", len(records), records, from, to-1)
+	}
+	for i, record := range records {
+		if expected := fmt.Sprintf("record-%03d", from+i); record != expected {
+			t.Fatalf("record %d is %q, expected %q", i, record, expected)
+		}
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+// every test record takes 18 bytes on disk, so two of them fill 36 bytes segment
+const testRecordBytes = headerSize + 10
+
+func TestSegmentRollover(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l := openLog(t, Config{Dir: dir, SegmentBytes: 2 * testRecordBytes})
+	defer l.Close()
+
+	appendRecords(t, l, 0, 6)
+	if files := segmentFiles(t, dir); len(files) != 3 {
+		t.Errorf("6 records are written to %d segments, expected 3", len(files))
+	}
+
+	expectRecords(t, readRecords(t, l), 0, 6)
+	if err := l.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Errorf("%d segments are kept after commit, expected only active one", len(files))
+	}
+}
+
+func TestReplayAfterReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	conf := Config{Dir: dir, SegmentBytes: 2 * testRecordBytes}
+
+	l := openLog(t, conf)
+	appendRecords(t, l, 0, 5)
+	for i := 0; i < 3; i++ {
+		if _, _, err := l.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// record read after the last commit is not acknowledged and is replayed
+	if _, _, err := l.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l = openLog(t, conf)
+	if l.Len() != 2 {
+		t.Errorf("reopened log has %d unread records, expected 2", l.Len())
+	}
+	expectRecords(t, readRecords(t, l), 3, 5)
+
+	appendRecords(t, l, 5, 6)
+	expectRecords(t, readRecords(t, l), 5, 6)
+	if err := l.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l = openLog(t, conf)
+	defer l.Close()
+	if l.Len() != 0 {
+		t.Errorf("reopened log has %d unread records after everything is committed", l.Len())
+	}
+}
+
+func TestEvictionAtSizeLimit(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l := openLog(t, Config{Dir: dir, SegmentBytes: 2 * testRecordBytes, MaxBytes: 4 * testRecordBytes})
+	defer l.Close()
+
+	appendRecords(t, l, 0, 10)
+	if l.Evicted() != 6 || l.Len() != 4 {
+		t.Errorf("log evicted %d and kept %d records, expected 6 and 4", l.Evicted(), l.Len())
+	}
+	if files := segmentFiles(t, dir); len(files) != 2 {
+		t.Errorf("%d segments are kept, expected 2 within size limit", len(files))
+	}
+
+	expectRecords(t, readRecords(t, l), 6, 10)
+}
+
+func TestCorruptTailIsTruncated(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	conf := Config{Dir: dir}
+
+	l := openLog(t, conf)
+	appendRecords(t, l, 0, 3)
+	l.Close()
+
+	// torn write left by crash: complete header without the whole record
+	files := segmentFiles(t, dir)
+	file, err := os.OpenFile(files[len(files)-1], os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.Write([]byte{10, 0, 0, 0, 1, 2, 3, 4, 'r', 'e'}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	l = openLog(t, conf)
+	defer l.Close()
+	if l.Len() != 3 {
+		t.Errorf("log with corrupt tail has %d unread records, expected 3", l.Len())
+	}
+
+	appendRecords(t, l, 3, 4)
+	expectRecords(t, readRecords(t, l), 0, 4)
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -18,17 +20,27 @@ type routNode struct {
 
 func New(basePath string) *server {
 	return &server{
-		routing:  map[string]routNode{},
-		basePath: basePath,
+		routing:      map[string]routNode{},
+		basePath:     basePath,
+		shutdownDone: make(chan struct{}),
 	}
 }
 
 type server struct {
-	basePath    string
-	middlewares []HandleFunc
-	routing     map[string]routNode
+	basePath      string
+	middlewares   []HandleFunc
+	routing       map[string]routNode
+	mu            sync.Mutex
+	httpServer    *http.Server
+	shuttingDown  bool
+	shutdownHooks []ShutdownHook
+	shutdownDone  chan struct{}
+	shutdownErr   error
 }
 
+// ShutdownHook is called after http server has stopped, e.g. logging.Logger.Sync to flush queued logs
+type ShutdownHook func(ctx context.Context) error
+
 func (s *server) Use(middleware HandleFunc) {
 	s.middlewares = append(s.middlewares, middleware)
 }
@@ -41,8 +53,67 @@ func (s *server) Get(path string, handler HandleFunc) {
 	s.handle(http.MethodGet, path, handler)
 }
 
+func (s *server) OnShutdown(hook ShutdownHook) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+// Run serves requests until Shutdown, it returns after Shutdown has called every shutdown hook
 func (s *server) Run(port int) (err error) {
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), s)
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: s,
+	}
+
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		<-s.shutdownDone
+		return nil
+	}
+	s.httpServer = httpServer
+	s.mu.Unlock()
+
+	err = httpServer.ListenAndServe()
+	if err == http.ErrServerClosed {
+		<-s.shutdownDone
+		err = nil
+	}
+
+	return
+}
+
+// Shutdown gracefully stops http server and then calls shutdown hooks in registration order,
+// server which is not running yet will not start, repeated calls wait for the first one
+func (s *server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		select {
+		case <-s.shutdownDone:
+			return s.shutdownErr
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.shuttingDown = true
+	httpServer := s.httpServer
+	s.mu.Unlock()
+
+	var err error
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	}
+
+	for _, hook := range s.shutdownHooks {
+		if hookErr := hook(ctx); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
+
+	s.shutdownErr = err
+	close(s.shutdownDone)
+
+	return err
 }
 
 func (s *server) handle(method, path string, handler HandleFunc) {